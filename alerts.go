@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// alertLevels ranks the wanted levels that raise an alert, a player is alerted again when their level rises
+var alertLevels = map[string]int{
+	"suspicious": 1,
+	"wanted":     2,
+}
+
+// alert is a wanted or suspicious player who was seen on a server for the first time in this session
+type alert struct {
+	Number     int
+	ServerName string
+	Player     validatedPlayer
+	RaisedAt   time.Time
+	// Local is set if the alert is based on cached records, because the backend could not be reached
+	Local bool
+}
+
+// notification describes the alert for the notifiers
+func (a alert) notification() notification {
+	n := notification{
+		Event:       eventSuspicious,
+		Title:       "Suspicious player on " + a.ServerName,
+		Message:     fmt.Sprintf("%s (%s) is suspicious", a.Player.DisplayName, a.Player.PlayfabId),
+		ServerName:  a.ServerName,
+		PlayfabId:   a.Player.PlayfabId,
+		DisplayName: a.Player.DisplayName,
+		Charges:     a.Player.WantedFor,
+		Time:        a.RaisedAt,
+		Local:       a.Local,
+	}
+	if a.Player.WantedLevel == "wanted" {
+		n.Event = eventWanted
+		n.Title = "Wanted player on " + a.ServerName
+		n.Message = fmt.Sprintf("%s (%s) is wanted for %s", a.Player.DisplayName, a.Player.PlayfabId, strings.Join(a.Player.WantedFor, ", "))
+	}
+	return n
+}
+
+// alertManager decides which players are worth an alert. Every player is alerted once per server and session.
+type alertManager struct {
+	// alerted holds the level every player was last alerted with, per server
+	alerted map[string]map[string]string
+	// pending are the alerts that were not acknowledged yet, oldest first
+	pending []alert
+	next    int
+}
+
+func newAlertManager() *alertManager {
+	return &alertManager{
+		alerted: make(map[string]map[string]string),
+		next:    1,
+	}
+}
+
+// raise returns an alert for every player who is wanted or suspicious and wasn't alerted on the server before
+func (alerts *alertManager) raise(serverName string, players []validatedPlayer, local bool, now time.Time) (raised []alert) {
+	alerted, ok := alerts.alerted[serverName]
+	if !ok {
+		alerted = make(map[string]string)
+		alerts.alerted[serverName] = alerted
+	}
+	for _, player := range players {
+		level := alertLevels[player.WantedLevel]
+		if level == 0 || level <= alertLevels[alerted[player.PlayfabId]] {
+			continue
+		}
+		alerted[player.PlayfabId] = player.WantedLevel
+		newAlert := alert{alerts.next, serverName, player, now, local}
+		alerts.next++
+		alerts.pending = append(alerts.pending, newAlert)
+		raised = append(raised, newAlert)
+	}
+	return
+}
+
+// unacknowledged returns the pending alerts of the players that are still on the server
+func (alerts *alertManager) unacknowledged(serverName string, players []validatedPlayer) (pending []alert) {
+	for _, pendingAlert := range alerts.pending {
+		if pendingAlert.ServerName != serverName {
+			continue
+		}
+		if slices.ContainsFunc(players, func(player validatedPlayer) bool { return player.PlayfabId == pendingAlert.Player.PlayfabId }) {
+			pending = append(pending, pendingAlert)
+		}
+	}
+	return
+}
+
+// acknowledge dismisses the alert with the given number, 0 dismisses all alerts
+func (alerts *alertManager) acknowledge(number int) (count int, err error) {
+	if len(alerts.pending) == 0 {
+		return 0, errors.New("there are no pending alerts")
+	}
+	if number == 0 {
+		count = len(alerts.pending)
+		alerts.pending = nil
+		return
+	}
+	i := slices.IndexFunc(alerts.pending, func(pendingAlert alert) bool { return pendingAlert.Number == number })
+	if i < 0 {
+		return 0, fmt.Errorf("there is no pending alert %d", number)
+	}
+	alerts.pending = slices.Delete(alerts.pending, i, i+1)
+	return 1, nil
+}
+
+// acknowledgePlayer dismisses the alerts of a player the admin took care of
+func (alerts *alertManager) acknowledgePlayer(playfabId string) {
+	alerts.pending = slices.DeleteFunc(alerts.pending, func(pendingAlert alert) bool {
+		return pendingAlert.Player.PlayfabId == playfabId
+	})
+}
+
+// list returns the pending alerts, oldest first
+func (alerts *alertManager) list() []alert {
+	return alerts.pending
+}
@@ -0,0 +1,465 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/charmbracelet/log"
+	"io"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// EventSource produces text events until the context is cancelled
+type EventSource interface {
+	Watch(ctx context.Context) <-chan string
+}
+
+// ClipboardWriter receives the in-game commands that the admin should paste into the game console
+type ClipboardWriter interface {
+	WriteString(data string) error
+}
+
+// PlayerView shows the player table whenever it changes. Without a view the table is printed to the output.
+type PlayerView interface {
+	ShowPlayers(serverName string, validatedPlayers []validatedPlayer)
+}
+
+// clipboardSource turns clipboard copy operations into events
+type clipboardSource struct {
+	clipboard ClipboardBackend
+	interval  time.Duration
+}
+
+func (s clipboardSource) Watch(ctx context.Context) <-chan string {
+	return watchClipboard(ctx, s.clipboard, s.interval)
+}
+
+// appOptions are the optional parts of the app. Features are disabled when their field is nil.
+type appOptions struct {
+	cache       *validationCache
+	wantedBoard *wantedBoard
+	// trust is kept in memory only when it's nil
+	trust *trustList
+	// format is one of outputFormats, the table is used when it's empty
+	format  string
+	view    PlayerView
+	confirm confirmPolicy
+	// undoWindow is how long global actions can be undone, undo is disabled when it's 0
+	undoWindow time.Duration
+	// journal is kept in memory only when it's nil
+	journal *actionJournal
+	// charges are the predefined ban charges, none are known when it's nil
+	charges *chargeCatalogue
+	// notifications tells the admin and their team about alerts and bans
+	notifications *notificationRouter
+	// showServer is told the name of the server that commands refer to, whenever it changes
+	showServer func(serverName string)
+}
+
+// App ties together the clipboard, the console and the backend
+type App struct {
+	appOptions
+	svc             playerService
+	clipboardEvents EventSource
+	commandEvents   EventSource
+	clipboard       ClipboardWriter
+	out             io.Writer
+
+	// sessions holds the state of every scanned server in the order they were first scanned,
+	// session is the one commands refer to
+	sessions   []*serverSession
+	session    *serverSession
+	completion atomic.Pointer[completionState]
+	// pending is an action that waits until the admin confirms it
+	pending *pendingAction
+	alerts  *alertManager
+	// showingCache is set while the current table holds cached results that are being revalidated
+	showingCache bool
+
+	// Validation runs in the background so that commands keep working while the backend is busy
+	validations      chan validationResult
+	generation       int
+	cancelValidation context.CancelFunc
+}
+
+// validationResult is published by a background validation once the backend has answered
+type validationResult struct {
+	generation         int
+	checkedWantedBoard bool
+	serverName         string
+	players            []validatedPlayer
+	err                error
+}
+
+// newApp creates an app that validates listplayers dumps from clipboardEvents,
+// executes commands from commandEvents and writes tables to out
+func newApp(svc playerService, clipboardEvents, commandEvents EventSource, clipboard ClipboardWriter, out io.Writer, options appOptions) *App {
+	if options.trust == nil {
+		options.trust = newTrustList("")
+	}
+	if options.format == "" {
+		options.format = "table"
+	}
+	if options.confirm == "" {
+		options.confirm = confirmBans
+	}
+	if options.charges == nil {
+		options.charges = &chargeCatalogue{charges: shippedCharges}
+	}
+	if options.notifications == nil {
+		options.notifications = &notificationRouter{}
+	}
+	if options.journal == nil {
+		options.journal = newActionJournal(options.undoWindow)
+	}
+	return &App{
+		appOptions:      options,
+		svc:             svc,
+		clipboardEvents: clipboardEvents,
+		commandEvents:   commandEvents,
+		clipboard:       clipboard,
+		out:             out,
+		session:         newServerSession(""),
+		alerts:          newAlertManager(),
+		validations:     make(chan validationResult),
+	}
+}
+
+// Run processes events until the context is cancelled or one of the event sources is exhausted
+func (app *App) Run(ctx context.Context) {
+	clipboardEvents := app.clipboardEvents.Watch(ctx)
+	commandEvents := app.commandEvents.Watch(ctx)
+	defer app.stopValidation()
+	for {
+		select {
+		case event, ok := <-commandEvents:
+			if !ok {
+				return
+			}
+			app.handleCommand(ctx, event)
+		case event, ok := <-clipboardEvents:
+			if !ok {
+				return
+			}
+			app.handleClipboard(ctx, event)
+		case result := <-app.validations:
+			app.handleValidation(result)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// logPending shows the action that waits for a confirmation and why it has to be confirmed
+func (app *App) logPending() {
+	log.Warn("Command needs to be confirmed", "action", app.pending.summary)
+	for _, check := range app.pending.checks {
+		log.Warn("Check before confirming", "reason", check)
+	}
+}
+
+// handleCommand executes a console command and copies the resulting in-game command to the clipboard.
+// Actions that need a confirmation are kept until the admin confirms or enters another command.
+func (app *App) handleCommand(ctx context.Context, command string) {
+	var inGameCommand string
+	var err error
+	if command == "confirm" {
+		pending := app.pending
+		if pending == nil {
+			log.Warn("There is no command to confirm")
+			return
+		}
+		app.pending = nil
+		inGameCommand, err = pending.run(ctx)
+	} else {
+		app.pending = nil
+		inGameCommand, err = app.executeCommand(ctx, command)
+	}
+	if errors.Is(err, errConfirmationRequired) {
+		app.logPending()
+		log.Info("Type confirm to execute it")
+		return
+	}
+	if errors.Is(err, errDryRun) {
+		return
+	}
+	if err != nil {
+		logError("Failed to execute command", err)
+		return
+	}
+	if inGameCommand != "" {
+		err = app.clipboard.WriteString(inGameCommand)
+		if err != nil {
+			log.Warn("Failed to write command to clipboard", "err", err)
+		} else {
+			log.Info("In-game command was copied to clipboard", "command", inGameCommand)
+		}
+	}
+}
+
+// handleClipboard validates the player list if the clipboard contains a listplayers output
+func (app *App) handleClipboard(ctx context.Context, data string) {
+	if !strings.HasPrefix(data, "ServerName - ") {
+		return
+	}
+	serverName, players, err := readPlayerList(data)
+	if err != nil {
+		log.Warn("Failed to read player list", "err", err)
+		if len(players) == 0 {
+			return
+		}
+	}
+	log.Info("Validating players", "server", serverName, "count", len(players))
+	app.startValidation(ctx, serverName, players)
+	// Commands refer to the server that was just scanned. Both the local and the validated results
+	// are compared with the previous scan of the server.
+	session := app.sessionFor(serverName)
+	session.diffBase = session.lastScan
+	app.switchSession(session)
+
+	// Show what is known about the players while the backend is working
+	app.showingCache = false
+	knownPlayers, cached, wanted := app.lookupLocal(players)
+	if cached > 0 || wanted > 0 {
+		app.setPlayers(serverName, knownPlayers)
+		app.showingCache = true
+		// Cached records might be outdated, so they are only alerted once the backend confirmed them
+		log.Info("Showing local results while validating", "cached", cached, "wanted", wanted, "count", len(players))
+		if app.wantedBoard != nil && app.wantedBoard.upToDate() {
+			// The backend would only confirm the players on an up to date mirror, so they are alerted right away
+			app.raiseAlerts(serverName, app.wantedBoard.listed(app.session.players), false)
+		}
+		app.printPlayers()
+	}
+}
+
+// lookupLocal returns what the validation cache and the wanted board mirror know about the players
+func (app *App) lookupLocal(players []connectedPlayer) (validatedPlayers []validatedPlayer, cached, wanted int) {
+	if app.cache != nil {
+		validatedPlayers, cached = app.cache.lookup(players)
+	} else {
+		validatedPlayers = make([]validatedPlayer, 0, len(players))
+		for _, connected := range players {
+			validatedPlayers = append(validatedPlayers, validatedPlayer{
+				PlayfabId:   connected.PlayfabId,
+				DisplayName: connected.DisplayName,
+				Connection:  connected,
+			})
+		}
+	}
+	if app.wantedBoard != nil {
+		wanted = app.wantedBoard.apply(validatedPlayers)
+	}
+	app.trust.apply(validatedPlayers)
+	return
+}
+
+// startValidation validates the players in the background and replaces any validation that is still running,
+// since its result would be outdated anyway
+func (app *App) startValidation(ctx context.Context, serverName string, players []connectedPlayer) {
+	app.stopValidation()
+	app.generation++
+	validationCtx, cancel := context.WithCancel(ctx)
+	app.cancelValidation = cancel
+	// The backend only has to check the wanted board if the local mirror might be outdated
+	checkWantedBoard := app.wantedBoard == nil || !app.wantedBoard.upToDate()
+	go func(generation int) {
+		validatedPlayers, err := app.svc.validatePlayers(validationCtx, serverName, players, checkWantedBoard)
+		select {
+		case app.validations <- validationResult{
+			generation:         generation,
+			checkedWantedBoard: checkWantedBoard,
+			serverName:         serverName,
+			players:            validatedPlayers,
+			err:                err,
+		}:
+		case <-validationCtx.Done():
+		}
+	}(app.generation)
+}
+
+// stopValidation cancels the running validation, if there is one
+func (app *App) stopValidation() {
+	if app.cancelValidation != nil {
+		app.cancelValidation()
+		app.cancelValidation = nil
+	}
+}
+
+// handleValidation prints the validated players and makes them the target of commands
+func (app *App) handleValidation(result validationResult) {
+	if result.generation != app.generation {
+		// A newer listplayers output was copied in the meantime
+		return
+	}
+	app.stopValidation()
+	if result.err != nil {
+		logError("Failed to validate players", result.err)
+		if app.showingCache {
+			log.Warn("The table above shows local results, which might be outdated")
+			// The local results are all there is, but the alerts are not sent to the team since they might be outdated
+			app.alertPlayers(result.serverName, app.sessionFor(result.serverName).players, true)
+		}
+		return
+	}
+	if !result.checkedWantedBoard {
+		app.wantedBoard.apply(result.players)
+	}
+	app.reconcileTrust(result.players)
+	app.trust.apply(result.players)
+	if app.cache != nil {
+		err := app.cache.store(result.players)
+		if err != nil {
+			log.Warn("Failed to update validation cache", "err", err)
+		}
+	}
+	session := app.sessionFor(result.serverName)
+	if app.showingCache && sameValidation(session.players, result.players) {
+		// Keep the table, only the cache markers are outdated
+		app.setPlayers(result.serverName, result.players)
+		app.showingCache = false
+		log.Info("Validated players, cached results are up to date", "count", len(session.players))
+		app.alertPlayers(result.serverName, session.players, false)
+		return
+	}
+	app.setPlayers(result.serverName, result.players)
+	app.showingCache = false
+	log.Info("Validated players", "server", result.serverName, "count", len(session.players))
+	app.alertPlayers(result.serverName, session.players, false)
+	if session != app.session {
+		// The admin switched to another server while the backend was busy
+		log.Info("Type use to show the players of this server", "server", result.serverName)
+		return
+	}
+	app.printPlayers()
+}
+
+// alertPlayers alerts the admin about wanted and suspicious players who were not seen on the server before.
+// Players whose alerts were not acknowledged yet are mentioned again, but without a sound.
+// Alerts about cached records are local, since the records might be outdated.
+func (app *App) alertPlayers(serverName string, players []validatedPlayer, local bool) {
+	raised := app.raiseAlerts(serverName, players, local)
+	if len(raised) == 0 {
+		pending := app.alerts.unacknowledged(serverName, players)
+		if len(pending) > 0 {
+			log.Info("Players with unacknowledged alerts are still on the server, type alerts to list them or ack to dismiss them", "count", len(pending))
+		}
+	}
+}
+
+// raiseAlerts alerts the admin about the players who were not seen on the server before
+func (app *App) raiseAlerts(serverName string, players []validatedPlayer, local bool) (raised []alert) {
+	raised = app.alerts.raise(serverName, players, local, time.Now())
+	for _, raisedAlert := range raised {
+		log.Warn("Found a "+raisedAlert.Player.WantedLevel+" player", "alert", raisedAlert.Number,
+			"player", raisedAlert.Player.Number, "name", raisedAlert.Player.DisplayName, "server", serverName)
+		app.notifications.notify(raisedAlert.notification())
+	}
+	return
+}
+
+// setPlayers replaces the player table of a server, which commands refer to while it's the current server
+func (app *App) setPlayers(serverName string, validatedPlayers []validatedPlayer) {
+	session := app.sessionFor(serverName)
+	sortPlayers(validatedPlayers)
+	session.numbers.assign(validatedPlayers)
+	session.players = validatedPlayers
+	session.diff = diffScans(session.diffBase, validatedPlayers)
+	session.lastScan = playerScan{validatedPlayers, time.Now()}
+	app.updateCompletion()
+}
+
+// printPlayers shows the current player table in the view, or prints it in the selected output format
+func (app *App) printPlayers() {
+	if app.view != nil {
+		app.view.ShowPlayers(app.session.name, slices.Clone(app.session.players))
+		return
+	}
+	if app.format == "table" {
+		if app.session.hasDiff() {
+			printDiff(app.out, app.session.diff)
+		}
+		printTable(app.out, app.session.players)
+		return
+	}
+	report := newValidationReport("clipboard", app.session.name, app.session.players, nil)
+	err := printReports(app.out, app.format, []validationReport{report})
+	if err != nil {
+		log.Warn("Failed to print players", "err", err)
+	}
+}
+
+// reconcileTrust updates the local trust list with the trust state of the backend,
+// and drops the local entries of players whose trust expired. Expired trust is not revoked
+// on the backend automatically, since that would be a global action nobody confirmed.
+func (app *App) reconcileTrust(validatedPlayers []validatedPlayer) {
+	revoked, err := app.trust.reconcile(validatedPlayers)
+	for _, entry := range revoked {
+		log.Info("Trust was revoked on the backend, removed player from the local trust list", "player", entry.DisplayName, "id", entry.PlayfabId)
+	}
+	expired, expireErr := app.trust.removeExpired()
+	err = errors.Join(err, expireErr)
+	if err != nil {
+		log.Warn("Failed to save local trust list", "err", err)
+	}
+	for _, entry := range expired {
+		log.Warn("Trust expired, removed player from the local trust list. The player stays trusted on every SAK server until you revoke it",
+			"player", entry.DisplayName, "id", entry.PlayfabId, "command", "untrust "+entry.PlayfabId)
+	}
+}
+
+// sameValidation reports whether fresh validation results would print the same table as the cached ones,
+// apart from the cache markers
+func sameValidation(cached, fresh []validatedPlayer) bool {
+	if len(cached) != len(fresh) {
+		return false
+	}
+	cachedById := make(map[string]validatedPlayer, len(cached))
+	for _, player := range cached {
+		cachedById[player.PlayfabId] = player
+	}
+	for _, player := range fresh {
+		old, ok := cachedById[player.PlayfabId]
+		if !ok || old.CachedAt.IsZero() ||
+			old.DisplayName != player.DisplayName ||
+			old.WantedLevel != player.WantedLevel ||
+			old.BanCommand != player.BanCommand ||
+			!slices.Equal(old.WantedFor, player.WantedFor) ||
+			!slices.Equal(old.Aliases, player.Aliases) {
+			return false
+		}
+	}
+	return true
+}
+
+// notFoundHint explains a not found error, which means an unknown player for player actions
+// and a function the backend doesn't have for all other calls
+func notFoundHint(err error) string {
+	var backendErr *BackendError
+	if errors.As(err, &backendErr) && backendErr.Endpoint != "player_action" {
+		return "The backend has no " + backendErr.Endpoint + " function. Check the backend URL, or the backend doesn't support this yet"
+	}
+	return "The backend does not know this player"
+}
+
+// logError logs a failed operation, with advice that depends on how the backend call failed
+func logError(message string, err error) {
+	switch {
+	case errors.Is(err, ErrPermissionDenied):
+		log.Error(message, "err", err)
+		log.Info("Your credentials are not allowed to do this. If you think they should be, open a ticket on the SAK discord")
+	case errors.Is(err, ErrRateLimited):
+		log.Warn(message, "err", err)
+		log.Info("The backend is busy, try again in a minute")
+	case errors.Is(err, ErrNotFound):
+		log.Warn(message, "err", err)
+		log.Info(notFoundHint(err))
+	case errors.Is(err, ErrMalformedResponse):
+		log.Error(message, "err", err)
+		log.Info("The backend sent an unexpected response. If this error persists please create a bug report")
+	default:
+		log.Warn(message, "err", err)
+	}
+}
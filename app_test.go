@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"fmt"
+	"github.com/DEFSAK/chiv-admin-helper/internal/mockbackend"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testDump = "ServerName - DEFSAK Test 123\n" +
+	"Name - PlayFabID - EOSID - Score - Kills - Deaths\n" +
+	"Bob - AAAA000000000001 - eos1 - 10 - 2 - 3\n" +
+	"Alice - Smith - AAAA000000000002 - eos2 - 115 - 11 - 1\n" +
+	"Bot - NULL - NULL - 0 - 0 - 0\n"
+
+// testRecords are the player records the test backend starts with
+var testRecords = []mockbackend.Player{
+	{
+		PlayfabId:   "AAAA000000000002",
+		DisplayName: "Alice - Smith",
+		Aliases:     []string{"Al"},
+		CreatedAt:   time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		WantedFor:   []string{"cheating"},
+		WantedLevel: "wanted",
+		BanCommand:  "banbyid AAAA000000000002 0 cheating",
+	},
+}
+
+// newTestBackend creates a mock backend that knows testRecords
+func newTestBackend() *mockbackend.Backend {
+	return mockbackend.New("", testRecords)
+}
+
+// syncBuffer collects the output of the app, which is written from the app goroutine
+type syncBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (n int, err error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.String()
+}
+
+// newTestService connects a backend service to a test backend
+func newTestService(t *testing.T, handler http.Handler) backendService {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	cfg := defaultConfig
+	cfg.BackendUrl = server.URL
+	cfg.AuthMode = authNone
+	cfg.MaxRetries = 0
+	svc, err := newBackendService(cfg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return svc
+}
+
+// waitFor polls until the condition holds
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestApp(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	tests := []struct {
+		name    string
+		confirm confirmPolicy
+		// rescan pastes the dump again after Bob left
+		rescan   bool
+		commands []string
+		// out must contain all of these
+		out []string
+		// writes are the in-game commands that must be copied to the clipboard
+		writes []string
+		// actions are the player actions the backend must receive
+		actions []string
+	}{
+		{
+			name: "table",
+			out:  []string{"Alice - Smith", "Wanted for: cheating", "banbyid AAAA000000000002 0 cheating", "Bob"},
+		},
+		{
+			name:     "kick",
+			commands: []string{"kick 2"},
+			writes:   []string{"kickbyid AAAA000000000001"},
+		},
+		{
+			name:     "ban",
+			commands: []string{"ban 2 spam"},
+			writes:   []string{"banbyid AAAA000000000001 24 spam"},
+			actions:  []string{"ban AAAA000000000001 spam"},
+		},
+		{
+			name:     "ban waits for confirmation",
+			confirm:  confirmBans,
+			commands: []string{"ban 2 spam"},
+		},
+		{
+			name:     "ban is confirmed",
+			confirm:  confirmBans,
+			commands: []string{"ban 2 spam", "confirm"},
+			writes:   []string{"banbyid AAAA000000000001 24 spam"},
+			actions:  []string{"ban AAAA000000000001 spam"},
+		},
+		{
+			name:     "unknown charge is confirmed",
+			commands: []string{"ban 2 spm", "confirm"},
+			writes:   []string{"banbyid AAAA000000000001 0 spm"},
+			actions:  []string{"ban AAAA000000000001 spm"},
+		},
+		{
+			name:     "another command discards the pending action",
+			commands: []string{"ban 2 spm", "kick 1", "confirm"},
+			writes:   []string{"kickbyid AAAA000000000002"},
+		},
+		{
+			name:     "player who left needs confirmation",
+			rescan:   true,
+			commands: []string{"ban 2 spam"},
+		},
+		{
+			name:     "player who left is confirmed",
+			rescan:   true,
+			commands: []string{"ban 2 spam", "confirm"},
+			writes:   []string{"banbyid AAAA000000000001 24 spam"},
+			actions:  []string{"ban AAAA000000000001 spam"},
+		},
+		{
+			name:     "unknown player",
+			commands: []string{"kick 9", "ban 9 spam", "confirm"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			backend := newTestBackend()
+			svc := newTestService(t, backend)
+			clipboardEvents, commandEvents := newFakeEvents(), newFakeEvents()
+			clipboard := &fakeClipboard{}
+			out := &syncBuffer{}
+			options := appOptions{
+				confirm: cmp.Or(test.confirm, confirmNever),
+				charges: &chargeCatalogue{charges: []banCharge{{"spam", 24, "Spamming chat or voice"}}},
+			}
+			app := newApp(svc, clipboardEvents, commandEvents, clipboard, out, options)
+			done := make(chan struct{})
+			go func() {
+				app.Run(context.Background())
+				close(done)
+			}()
+
+			clipboardEvents.Send(testDump)
+			waitFor(t, "the player table", func() bool { return strings.Contains(out.String(), "Alice") })
+			if test.rescan {
+				clipboardEvents.Send(strings.Replace(testDump, "Bob - AAAA000000000001 - eos1 - 10 - 2 - 3\n", "", 1))
+				waitFor(t, "the second player table", func() bool { return strings.Count(out.String(), "Alice") == 2 })
+			}
+			for _, command := range test.commands {
+				commandEvents.Send(command)
+			}
+			// The app finishes the last command before it notices that the commands ended
+			commandEvents.Close()
+			<-done
+
+			for _, want := range test.out {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("output does not contain %q:\n%s", want, out.String())
+				}
+			}
+			if writes := clipboard.Writes(); !slices.Equal(writes, test.writes) {
+				t.Errorf("clipboard writes = %q, want %q", writes, test.writes)
+			}
+			if !slices.Equal(backend.Actions(), test.actions) {
+				t.Errorf("player actions = %q, want %q", backend.Actions(), test.actions)
+			}
+		})
+	}
+}
+
+// recordingNotifier remembers the players it was told about
+type recordingNotifier struct {
+	lock    sync.Mutex
+	players []string
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, notification notification) error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.players = append(n.players, notification.PlayfabId)
+	return nil
+}
+
+func (n *recordingNotifier) notified() []string {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return slices.Clone(n.players)
+}
+
+func TestAlertSources(t *testing.T) {
+	// Bob was wanted when he was last validated, but the backend cleared him since
+	staleBob := map[string]cachedPlayer{
+		"AAAA000000000001": {
+			Player:      validatedPlayer{PlayfabId: "AAAA000000000001", DisplayName: "Bob", WantedFor: []string{"spam"}, WantedLevel: "wanted"},
+			ValidatedAt: time.Now(),
+		},
+	}
+	wantedBob := map[string]wantedEntry{"AAAA000000000001": {PlayfabId: "AAAA000000000001", WantedFor: []string{"spam"}}}
+	down := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "backend is down", http.StatusInternalServerError)
+	})
+	tests := []struct {
+		name    string
+		backend http.Handler
+		cached  map[string]cachedPlayer
+		// mirror is the wanted board, synced lastSync ago with an interval of an hour
+		mirror   map[string]wantedEntry
+		lastSync time.Duration
+		// bell and discord are the players the local and the remote notifier must be told about
+		bell    []string
+		discord []string
+	}{
+		{"stale cache", newTestBackend(), staleBob, nil, 0, []string{"AAAA000000000002"}, []string{"AAAA000000000002"}},
+		{"cache while the backend is down", down, staleBob, nil, 0, []string{"AAAA000000000001"}, nil},
+		{"up to date mirror while the backend is down", down, nil, wantedBob, time.Minute, []string{"AAAA000000000001"}, []string{"AAAA000000000001"}},
+		{"outdated mirror while the backend is down", down, nil, wantedBob, 3 * time.Hour, []string{"AAAA000000000001"}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+			bell, discord := &recordingNotifier{}, &recordingNotifier{}
+			options := appOptions{
+				confirm: confirmNever,
+				notifications: &notificationRouter{
+					timeout:   time.Second,
+					routes:    map[string][]string{eventWanted: {"bell", "discord"}},
+					notifiers: map[string]Notifier{"bell": bell, "discord": discord},
+				},
+			}
+			if test.cached != nil {
+				options.cache = &validationCache{maxAge: time.Hour, players: maps.Clone(test.cached)}
+			}
+			if test.mirror != nil {
+				options.wantedBoard = &wantedBoard{interval: time.Hour, state: wantedBoardState{
+					LastSync: time.Now().Add(-test.lastSync),
+					Entries:  test.mirror,
+				}}
+			}
+			clipboardEvents, commandEvents := newFakeEvents(), newFakeEvents()
+			app := newApp(newTestService(t, test.backend), clipboardEvents, commandEvents, &fakeClipboard{}, &syncBuffer{}, options)
+			done := make(chan struct{})
+			go func() {
+				app.Run(context.Background())
+				close(done)
+			}()
+
+			clipboardEvents.Send(testDump)
+			waitFor(t, "the alert", func() bool { return len(bell.notified()) > 0 })
+			commandEvents.Close()
+			<-done
+			app.notifications.wait()
+			if notified := bell.notified(); !slices.Equal(notified, test.bell) {
+				t.Errorf("bell was told about %q, want %q", notified, test.bell)
+			}
+			if notified := discord.notified(); !slices.Equal(notified, test.discord) {
+				t.Errorf("discord was told about %q, want %q", notified, test.discord)
+			}
+		})
+	}
+}
+
+func TestExpiredTrustIsNotRevoked(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	trust := newTrustList("admin")
+	expiresAt := time.Now().Add(-time.Minute)
+	trust.entries["AAAA000000000001"] = trustEntry{PlayfabId: "AAAA000000000001", DisplayName: "Bob", ExpiresAt: &expiresAt, Confirmed: true}
+	backend := newTestBackend()
+	clipboardEvents, commandEvents := newFakeEvents(), newFakeEvents()
+	options := appOptions{trust: trust, confirm: confirmNever}
+	out := &syncBuffer{}
+	app := newApp(newTestService(t, backend), clipboardEvents, commandEvents, &fakeClipboard{}, out, options)
+	done := make(chan struct{})
+	go func() {
+		app.Run(context.Background())
+		close(done)
+	}()
+
+	clipboardEvents.Send(testDump)
+	// The table is printed once the validation result was handled
+	waitFor(t, "the player table", func() bool { return strings.Contains(out.String(), "Alice") })
+	commandEvents.Close()
+	<-done
+	if entries := trust.list(); len(entries) != 0 {
+		t.Errorf("trust list = %+v, want the expired entry to be dropped", entries)
+	}
+	if len(backend.Actions()) != 0 {
+		t.Errorf("player actions = %q, want none without confirmation", backend.Actions())
+	}
+}
+
+func TestNotFoundHint(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"player action", &BackendError{Endpoint: "player_action", Action: "ban", Err: ErrNotFound}, "The backend does not know this player"},
+		{"ban charges", &BackendError{Endpoint: "ban_charges", Err: ErrNotFound}, "The backend has no ban_charges function"},
+		{"lookup", fmt.Errorf("lookup failed: %w", &BackendError{Endpoint: "lookup_players", Err: ErrNotFound}), "The backend has no lookup_players function"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if hint := notFoundHint(test.err); !strings.HasPrefix(hint, test.want) {
+				t.Errorf("hint = %q, want %q", hint, test.want)
+			}
+		})
+	}
+}
+
+func TestLookupFallback(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		found []string
+		// err is part of the expected error, empty if the lookup succeeds
+		err string
+	}{
+		{"playfab id", "AAAA000000000002", []string{"Alice - Smith"}, ""},
+		{"lower case playfab id", "aaaa000000000002", []string{"Alice - Smith"}, ""},
+		{"name", "Alice", nil, "lookup_players"},
+	}
+	backend := newTestBackend()
+	withoutLookup := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "lookup_players") {
+			http.NotFound(w, r)
+			return
+		}
+		backend.ServeHTTP(w, r)
+	})
+	app := newApp(newTestService(t, withoutLookup), newFakeEvents(), newFakeEvents(), &fakeClipboard{}, io.Discard, appOptions{})
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			found, err := app.lookupPlayers(context.Background(), test.query)
+			switch {
+			case test.err == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+				t.Fatalf("error = %v, want it to contain %q", err, test.err)
+			}
+			var names []string
+			for _, player := range found {
+				names = append(names, player.DisplayName)
+			}
+			if !slices.Equal(names, test.found) {
+				t.Errorf("found %q, want %q", names, test.found)
+			}
+		})
+	}
+}
@@ -1,38 +1,162 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/charmbracelet/log"
 	"google.golang.org/api/idtoken"
 	"io"
 	"net/http"
-	"slices"
+	"strings"
 	"time"
 )
 
-const (
-	validateUrl = "https://europe-west3-prj-prd-chiv-01.cloudfunctions.net/func-prd-validate_players"
-	actionUrl   = "https://europe-west3-prj-prd-chiv-01.cloudfunctions.net/func-prd-player_action"
+var (
+	ErrPermissionDenied  = errors.New("permission denied")
+	ErrNotFound          = errors.New("not found")
+	ErrRateLimited       = errors.New("rate limited")
+	ErrMalformedResponse = errors.New("malformed response")
 )
 
+// BackendError describes a failed call to one of the backend functions.
+// Err is one of the sentinel errors above, the transport error, or nil for other HTTP errors.
+type BackendError struct {
+	// StatusCode is 0 when no response was received
+	StatusCode int
+	Endpoint   string
+	Action     string
+	// Message is the error message sent by the server
+	Message string
+	Err     error
+}
+
+func (e *BackendError) Error() string {
+	text := "call to " + e.Endpoint + " backend failed"
+	if e.Action != "" {
+		text += " (" + e.Action + ")"
+	}
+	if e.Err != nil {
+		text += ": " + e.Err.Error()
+	} else if e.StatusCode != 0 {
+		text += ": " + http.StatusText(e.StatusCode)
+	}
+	if e.Message != "" {
+		text += ": " + e.Message
+	}
+	return text
+}
+
+func (e *BackendError) Unwrap() error {
+	return e.Err
+}
+
+// readResponse checks the status of a backend response and decodes its JSON body into respData
+func readResponse(resp *http.Response, endpoint, action string, respData any) error {
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return &BackendError{StatusCode: resp.StatusCode, Endpoint: endpoint, Action: action, Err: err}
+	}
+	if resp.StatusCode >= 400 {
+		backendErr := &BackendError{
+			StatusCode: resp.StatusCode,
+			Endpoint:   endpoint,
+			Action:     action,
+			Message:    strings.TrimSpace(string(respBody)),
+		}
+		switch resp.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden:
+			backendErr.Err = ErrPermissionDenied
+		case http.StatusNotFound:
+			backendErr.Err = ErrNotFound
+		case http.StatusTooManyRequests:
+			backendErr.Err = ErrRateLimited
+		}
+		return backendErr
+	}
+	err = json.Unmarshal(respBody, respData)
+	if err != nil {
+		return &BackendError{StatusCode: resp.StatusCode, Endpoint: endpoint, Action: action, Message: err.Error(), Err: ErrMalformedResponse}
+	}
+	return nil
+}
+
+// playerService is the part of the backend that the app depends on
+type playerService interface {
+	validatePlayers(ctx context.Context, serverName string, players []connectedPlayer, checkWantedBoard bool) (validatedPlayers []validatedPlayer, err error)
+	playerAction(ctx context.Context, action, playfabId string, params map[string]any) (outputCommand string, err error)
+	lookupPlayers(ctx context.Context, query string) (players []validatedPlayer, err error)
+}
+
+// errDryRun is returned instead of sending player actions in dry-run mode
+var errDryRun = errors.New("dry run, action was not sent")
+
+// dryRunService validates players as usual, but only logs the player actions that would be sent
+type dryRunService struct {
+	playerService
+}
+
+func (svc dryRunService) playerAction(ctx context.Context, action, playfabId string, params map[string]any) (outputCommand string, err error) {
+	log.Info("Dry run, not sending player action", "action", action, "id", playfabId, "params", params)
+	return "", errDryRun
+}
+
+// actionService returns the service that player actions should be sent with
+func actionService(cfg config, svc playerService) playerService {
+	if cfg.DryRun {
+		return dryRunService{svc}
+	}
+	return svc
+}
+
 type backendService struct {
+	timeout        time.Duration
+	maxRetries     int
+	validateUrl    string
+	actionUrl      string
+	syncUrl        string
+	chargesUrl     string
+	lookupUrl      string
 	validateClient *http.Client
 	actionClient   *http.Client
+	syncClient     *http.Client
+	chargesClient  *http.Client
+	lookupClient   *http.Client
 }
 
-// newBackendService creates an authenticated client for validation and banning
-func newBackendService(credentialsPath string) (svc backendService, err error) {
-	ctx := context.Background()
-	credentialsFile := idtoken.WithCredentialsFile(credentialsPath)
-	svc.validateClient, err = idtoken.NewClient(ctx, validateUrl, credentialsFile)
+// newBackendService creates an authenticated client for validation and banning.
+// The credentials path is only used by the idtoken auth mode.
+func newBackendService(cfg config, credentialsPath string) (svc backendService, err error) {
+	svc.timeout = time.Duration(cfg.RequestTimeout)
+	svc.maxRetries = cfg.MaxRetries
+	svc.validateUrl = cfg.endpoint("validate_players")
+	svc.actionUrl = cfg.endpoint("player_action")
+	svc.syncUrl = cfg.endpoint("wanted_board_sync")
+	svc.chargesUrl = cfg.endpoint("ban_charges")
+	svc.lookupUrl = cfg.endpoint("lookup_players")
+	svc.validateClient, err = newAuthenticatedClient(cfg, credentialsPath, svc.validateUrl)
+	if err != nil {
+		err = fmt.Errorf("authentication failed: %w", err)
+		return
+	}
+	svc.actionClient, err = newAuthenticatedClient(cfg, credentialsPath, svc.actionUrl)
+	if err != nil {
+		err = fmt.Errorf("authentication failed: %w", err)
+		return
+	}
+	svc.syncClient, err = newAuthenticatedClient(cfg, credentialsPath, svc.syncUrl)
+	if err != nil {
+		err = fmt.Errorf("authentication failed: %w", err)
+		return
+	}
+	svc.chargesClient, err = newAuthenticatedClient(cfg, credentialsPath, svc.chargesUrl)
 	if err != nil {
 		err = fmt.Errorf("authentication failed: %w", err)
 		return
 	}
-	svc.actionClient, err = idtoken.NewClient(ctx, actionUrl, credentialsFile)
+	svc.lookupClient, err = newAuthenticatedClient(cfg, credentialsPath, svc.lookupUrl)
 	if err != nil {
 		err = fmt.Errorf("authentication failed: %w", err)
 		return
@@ -40,6 +164,30 @@ func newBackendService(credentialsPath string) (svc backendService, err error) {
 	return
 }
 
+// newAuthenticatedClient creates an HTTP client that authenticates against the given endpoint
+func newAuthenticatedClient(cfg config, credentialsPath, audience string) (*http.Client, error) {
+	switch cfg.AuthMode {
+	case authToken:
+		return &http.Client{Transport: bearerTransport{token: cfg.Token, base: http.DefaultTransport}}, nil
+	case authNone:
+		return &http.Client{}, nil
+	default:
+		return idtoken.NewClient(context.Background(), audience, idtoken.WithCredentialsFile(credentialsPath))
+	}
+}
+
+// bearerTransport adds a static bearer token to every request
+type bearerTransport struct {
+	token string
+	base  http.RoundTripper
+}
+
+func (t bearerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	return t.base.RoundTrip(req)
+}
+
 type validatedPlayer struct {
 	PlayfabId   string    `json:"playfab_id"`
 	DisplayName string    `json:"display_name"`
@@ -49,58 +197,72 @@ type validatedPlayer struct {
 	BanCommand  string    `json:"ban_command"`
 	WantedFor   []string  `json:"wanted_for"`
 	WantedLevel string    `json:"wanted_level"`
+	// Connection is the listplayers row the player was validated from
+	Connection connectedPlayer `json:"-"`
+	// CachedAt is the time the record was validated, if it was taken from the local cache
+	CachedAt time.Time `json:"-"`
+	// Number identifies the player in console commands for the whole session
+	Number int `json:"-"`
 }
 
 type connectedPlayer struct {
 	DisplayName string `json:"display_name"`
 	PlayfabId   string `json:"playfab_id"`
+	EosId       string `json:"eos_id,omitempty"`
+	Team        string `json:"team,omitempty"`
+	Score       *int   `json:"score,omitempty"`
+	Kills       *int   `json:"kills,omitempty"`
+	Deaths      *int   `json:"deaths,omitempty"`
+	Ping        *int   `json:"ping,omitempty"`
+	// Columns holds every column of the listplayers row after the display name, in the order the game printed them
+	Columns []playerColumn `json:"-"`
+}
+
+// playerColumn is a single named value of a listplayers row
+type playerColumn struct {
+	Name  string
+	Value string
 }
 
-// validatePlayers sends a list of players to the validation endpoint and returns all information
-func (svc backendService) validatePlayers(serverName string, players []connectedPlayer) (validatedPlayers []validatedPlayer, err error) {
+// validatePlayers sends a list of players to the validation endpoint and returns all information.
+// The wanted board check can be skipped when the local mirror is up to date.
+func (svc backendService) validatePlayers(ctx context.Context, serverName string, players []connectedPlayer, checkWantedBoard bool) (validatedPlayers []validatedPlayer, err error) {
 	reqParams := struct {
 		CheckWantedBoard bool              `json:"check_wanted_board"`
 		ServerName       string            `json:"server_name"`
 		Players          []connectedPlayer `json:"players"`
 	}{
-		CheckWantedBoard: true,
+		CheckWantedBoard: checkWantedBoard,
 		ServerName:       serverName,
 		Players:          players,
 	}
 	body, _ := json.Marshal(reqParams)
-	req, _ := http.NewRequest(http.MethodPost, validateUrl, bytes.NewReader(body))
-	resp, err := svc.validateClient.Do(req)
+	resp, err := svc.post(ctx, svc.validateClient, svc.validateUrl, body)
 	if err != nil {
-		err = fmt.Errorf("call to validate backend failed: %w", err)
+		err = &BackendError{Endpoint: "validate_players", Err: err}
 		return
 	}
-	if resp.StatusCode == 403 {
-		err = errors.New("call to validate backend failed: permission denied")
-		return
-	}
-	respBody, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode >= 400 {
-		err = fmt.Errorf("call to validate backend failed: %s", string(respBody))
-		return
-	}
-
 	respData := struct {
 		ValidatedPlayers []validatedPlayer `json:"validated_players"`
 	}{}
-	_ = json.Unmarshal(respBody, &respData)
+	err = readResponse(resp, "validate_players", "", &respData)
+	if err != nil {
+		return
+	}
 	validatedPlayers = respData.ValidatedPlayers
+	connections := make(map[string]connectedPlayer, len(players))
+	for _, player := range players {
+		connections[player.PlayfabId] = player
+	}
 	for i, player := range validatedPlayers {
-		if slices.Contains(localTrustList, player.PlayfabId) && player.WantedLevel == "suspicious" {
-			validatedPlayers[i].WantedLevel = ""
-			validatedPlayers[i].BanCommand = ""
-		}
+		validatedPlayers[i].Connection = connections[player.PlayfabId]
 	}
 	return
 }
 
 // playerAction executes an action that targets a single player. For example banning, unbanning or trusting.
 // These action may result in a command that should be run on the server.
-func (svc backendService) playerAction(action, playfabId string, params map[string]any) (outputCommand string, err error) {
+func (svc backendService) playerAction(ctx context.Context, action, playfabId string, params map[string]any) (outputCommand string, err error) {
 	reqParams := struct {
 		Action     string         `json:"action"`
 		PlayFabId  string         `json:"playfab_id"`
@@ -111,25 +273,84 @@ func (svc backendService) playerAction(action, playfabId string, params map[stri
 		Parameters: params,
 	}
 	body, _ := json.Marshal(reqParams)
-	req, _ := http.NewRequest(http.MethodPost, actionUrl, bytes.NewReader(body))
-	resp, err := svc.actionClient.Do(req)
+	resp, err := svc.postAction(ctx, svc.actionClient, svc.actionUrl, body)
+	if err != nil {
+		err = &BackendError{Endpoint: "player_action", Action: action, Err: err}
+		return
+	}
+	respData := struct {
+		OutputCommand string `json:"output_command"`
+	}{}
+	err = readResponse(resp, "player_action", action, &respData)
 	if err != nil {
-		err = fmt.Errorf("call to player action backend failed: %w", err)
+		return
 	}
-	if resp.StatusCode == 403 {
-		err = errors.New("call to player action backend failed: permission denied")
+	outputCommand = respData.OutputCommand
+	return
+}
+
+// lookupPlayers searches the player records by PlayFab ID, display name or alias
+func (svc backendService) lookupPlayers(ctx context.Context, query string) (players []validatedPlayer, err error) {
+	reqParams := struct {
+		Query string `json:"query"`
+	}{
+		Query: query,
+	}
+	body, _ := json.Marshal(reqParams)
+	resp, err := svc.post(ctx, svc.lookupClient, svc.lookupUrl, body)
+	if err != nil {
+		err = &BackendError{Endpoint: "lookup_players", Err: err}
 		return
 	}
-	respBody, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode >= 400 {
-		err = fmt.Errorf("call to player action backend failed: %s", string(respBody))
+	respData := struct {
+		Players []validatedPlayer `json:"players"`
+	}{}
+	err = readResponse(resp, "lookup_players", "", &respData)
+	if err != nil {
 		return
 	}
+	return respData.Players, nil
+}
 
+// syncWantedBoard fetches the wanted board changes since the cursor. An empty cursor returns the whole board.
+// When more is set, the changes are incomplete and have to be fetched again with the returned cursor.
+func (svc backendService) syncWantedBoard(ctx context.Context, cursor string) (changes []wantedEntry, nextCursor string, more bool, err error) {
+	reqParams := struct {
+		Cursor string `json:"cursor"`
+	}{
+		Cursor: cursor,
+	}
+	body, _ := json.Marshal(reqParams)
+	resp, err := svc.post(ctx, svc.syncClient, svc.syncUrl, body)
+	if err != nil {
+		err = &BackendError{Endpoint: "wanted_board_sync", Err: err}
+		return
+	}
 	respData := struct {
-		OutputCommand string `json:"output_command"`
+		Changes []wantedEntry `json:"changes"`
+		Cursor  string        `json:"cursor"`
+		More    bool          `json:"more"`
 	}{}
-	_ = json.Unmarshal(respBody, &respData)
-	outputCommand = respData.OutputCommand
-	return
+	err = readResponse(resp, "wanted_board_sync", "", &respData)
+	if err != nil {
+		return
+	}
+	return respData.Changes, respData.Cursor, respData.More, nil
+}
+
+// banCharges fetches the catalogue of predefined ban charges
+func (svc backendService) banCharges(ctx context.Context) (charges []banCharge, err error) {
+	resp, err := svc.post(ctx, svc.chargesClient, svc.chargesUrl, []byte("{}"))
+	if err != nil {
+		err = &BackendError{Endpoint: "ban_charges", Err: err}
+		return
+	}
+	respData := struct {
+		Charges []banCharge `json:"charges"`
+	}{}
+	err = readResponse(resp, "ban_charges", "", &respData)
+	if err != nil {
+		return
+	}
+	return respData.Charges, nil
 }
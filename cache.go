@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const cacheFileName = "validation_cache.json"
+
+// cachedPlayer is a validation result together with the time it was received from the backend
+type cachedPlayer struct {
+	Player      validatedPlayer `json:"player"`
+	ValidatedAt time.Time       `json:"validated_at"`
+}
+
+// validationCache remembers the latest validation result of every player, so results can be shown
+// before the backend answers and when it can't be reached at all
+type validationCache struct {
+	maxAge  time.Duration
+	players map[string]cachedPlayer
+}
+
+// loadValidationCache reads the cache from the config dir, dropping entries older than maxAge
+func loadValidationCache(maxAge time.Duration) (cache *validationCache, err error) {
+	cache = &validationCache{
+		maxAge:  maxAge,
+		players: make(map[string]cachedPlayer),
+	}
+	err = loadJson(cacheFileName, &cache.players)
+	if err != nil {
+		cache.players = make(map[string]cachedPlayer)
+		return
+	}
+	for playfabId, cached := range cache.players {
+		if time.Since(cached.ValidatedAt) > maxAge {
+			delete(cache.players, playfabId)
+		}
+	}
+	return
+}
+
+// lookup returns the cached results for the connected players. Players that are not cached are included
+// without validation data, so the table stays complete. found is the number of cached players.
+func (cache *validationCache) lookup(players []connectedPlayer) (validatedPlayers []validatedPlayer, found int) {
+	validatedPlayers = make([]validatedPlayer, 0, len(players))
+	for _, connected := range players {
+		cached, ok := cache.players[connected.PlayfabId]
+		if !ok || time.Since(cached.ValidatedAt) > cache.maxAge {
+			validatedPlayers = append(validatedPlayers, validatedPlayer{
+				PlayfabId:   connected.PlayfabId,
+				DisplayName: connected.DisplayName,
+				Connection:  connected,
+			})
+			continue
+		}
+		player := cached.Player
+		player.DisplayName = connected.DisplayName
+		player.Connection = connected
+		player.CachedAt = cached.ValidatedAt
+		validatedPlayers = append(validatedPlayers, player)
+		found++
+	}
+	return
+}
+
+// store adds fresh validation results to the cache and saves it
+func (cache *validationCache) store(validatedPlayers []validatedPlayer) error {
+	now := time.Now()
+	for _, player := range validatedPlayers {
+		player.CachedAt = time.Time{}
+		cache.players[player.PlayfabId] = cachedPlayer{Player: player, ValidatedAt: now}
+	}
+	for playfabId, cached := range cache.players {
+		if now.Sub(cached.ValidatedAt) > cache.maxAge {
+			delete(cache.players, playfabId)
+		}
+	}
+	return saveJson(cacheFileName, cache.players)
+}
+
+// formatAge shortens a duration to its largest unit, for example 5m or 2d
+func formatAge(age time.Duration) string {
+	switch {
+	case age < time.Minute:
+		return fmt.Sprintf("%ds", int(age.Seconds()))
+	case age < time.Hour:
+		return fmt.Sprintf("%dm", int(age.Minutes()))
+	case age < 24*time.Hour:
+		return fmt.Sprintf("%dh", int(age.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(age.Hours()/24))
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCacheLookup(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	validatedAt := time.Now().Add(-time.Hour)
+	cache := &validationCache{maxAge: 2 * time.Hour, players: map[string]cachedPlayer{
+		"AAAA000000000001": {
+			Player:      validatedPlayer{PlayfabId: "AAAA000000000001", DisplayName: "Bob", WantedLevel: "suspicious"},
+			ValidatedAt: validatedAt,
+		},
+		"AAAA000000000002": {
+			Player:      validatedPlayer{PlayfabId: "AAAA000000000002", DisplayName: "Alice", WantedLevel: "wanted"},
+			ValidatedAt: time.Now().Add(-3 * time.Hour),
+		},
+	}}
+	tests := []struct {
+		name      string
+		player    connectedPlayer
+		found     int
+		wantLevel string
+		cachedAt  time.Time
+	}{
+		{"hit", connectedPlayer{PlayfabId: "AAAA000000000001", DisplayName: "Bobby"}, 1, "suspicious", validatedAt},
+		{"expired", connectedPlayer{PlayfabId: "AAAA000000000002", DisplayName: "Alice"}, 0, "", time.Time{}},
+		{"miss", connectedPlayer{PlayfabId: "AAAA000000000003", DisplayName: "Carl"}, 0, "", time.Time{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			validatedPlayers, found := cache.lookup([]connectedPlayer{test.player})
+			if found != test.found || len(validatedPlayers) != 1 {
+				t.Fatalf("found %d of %d players, want %d of 1", found, len(validatedPlayers), test.found)
+			}
+			player := validatedPlayers[0]
+			// The name of the dump is shown, it might have changed since the player was cached
+			if player.DisplayName != test.player.DisplayName || player.WantedLevel != test.wantLevel || !player.CachedAt.Equal(test.cachedAt) {
+				t.Errorf("player = %+v, want %q with wanted level %q cached at %v", player, test.player.DisplayName, test.wantLevel, test.cachedAt)
+			}
+		})
+	}
+
+	// Storing results drops the expired entries and survives a restart
+	err := cache.store([]validatedPlayer{{PlayfabId: "AAAA000000000003", DisplayName: "Carl", CachedAt: validatedAt}})
+	if err != nil {
+		t.Fatalf("store failed: %v", err)
+	}
+	loaded, err := loadValidationCache(2 * time.Hour)
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if len(loaded.players) != 2 {
+		t.Errorf("cache holds %d players, want Bob and Carl", len(loaded.players))
+	}
+	if carl := loaded.players["AAAA000000000003"]; !carl.Player.CachedAt.IsZero() || time.Since(carl.ValidatedAt) > time.Minute {
+		t.Errorf("Carl = %+v, want a fresh entry without cache marker", carl)
+	}
+	// A shorter maximum age drops entries when the cache is loaded
+	loaded, _ = loadValidationCache(30 * time.Minute)
+	if _, ok := loaded.players["AAAA000000000001"]; ok || len(loaded.players) != 1 {
+		t.Errorf("cache holds %d players, want only Carl", len(loaded.players))
+	}
+}
+
+func TestFormatAge(t *testing.T) {
+	tests := []struct {
+		age  time.Duration
+		want string
+	}{
+		{5 * time.Second, "5s"},
+		{90 * time.Second, "1m"},
+		{3 * time.Hour, "3h"},
+		{50 * time.Hour, "2d"},
+	}
+	for _, test := range tests {
+		if age := formatAge(test.age); age != test.want {
+			t.Errorf("formatAge(%v) = %s, want %s", test.age, age, test.want)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/charmbracelet/log"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const chargesFileName = "ban_charges.json"
+
+// banCharge is a predefined ban reason with the ban duration and message the backend uses for it
+type banCharge struct {
+	Name string `json:"name"`
+	// Hours is the ban duration, 0 bans permanently
+	Hours   int    `json:"duration_hours"`
+	Message string `json:"message"`
+}
+
+// shippedCharges are used until the catalogue was fetched from the backend, and when the backend has no catalogue
+var shippedCharges = []banCharge{
+	{"admin_impersonation", 720, "Impersonating an admin"},
+	{"ban_evasion", 0, "Evading a ban"},
+	{"cheating", 0, "Cheating"},
+	{"exploiting", 168, "Exploiting bugs"},
+	{"ffa", 24, "Free for all in a team mode"},
+	{"griefing", 24, "Team killing or griefing"},
+	{"harassment", 72, "Harassing players"},
+	{"hate_speech", 720, "Hate speech"},
+	{"player_impersonation", 168, "Impersonating a player"},
+	{"spam", 24, "Spamming chat or voice"},
+}
+
+// chargeService fetches the catalogue of predefined charges from the backend
+type chargeService interface {
+	banCharges(ctx context.Context) (charges []banCharge, err error)
+}
+
+// chargeCatalogue knows the predefined charges, so bans can be checked before they are sent
+type chargeCatalogue struct {
+	lock    sync.RWMutex
+	charges []banCharge
+}
+
+// loadChargeCatalogue reads the catalogue that was last fetched from the backend, or falls back to the shipped charges
+func loadChargeCatalogue() (catalogue *chargeCatalogue, err error) {
+	catalogue = &chargeCatalogue{}
+	err = loadJson(chargesFileName, &catalogue.charges)
+	if err != nil || len(catalogue.charges) == 0 {
+		catalogue.charges = shippedCharges
+	}
+	return
+}
+
+// refresh fetches the current catalogue from the backend and saves it for the next start.
+// Backends without a ban charges function keep the shipped charges.
+func (catalogue *chargeCatalogue) refresh(ctx context.Context, svc chargeService) {
+	charges, err := svc.banCharges(ctx)
+	if errors.Is(err, ErrNotFound) {
+		log.Debug("Backend has no ban charges, using the shipped charges")
+		return
+	}
+	if err != nil {
+		logError("Failed to fetch ban charges, using the last known charges", err)
+		return
+	}
+	if len(charges) == 0 {
+		log.Warn("Backend returned no ban charges, using the last known charges")
+		return
+	}
+	slices.SortFunc(charges, func(a, b banCharge) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	catalogue.lock.Lock()
+	catalogue.charges = charges
+	catalogue.lock.Unlock()
+	err = saveJson(chargesFileName, charges)
+	if err != nil {
+		log.Warn("Failed to save ban charges", "err", err)
+	}
+}
+
+// list returns all charges sorted by name
+func (catalogue *chargeCatalogue) list() []banCharge {
+	catalogue.lock.RLock()
+	defer catalogue.lock.RUnlock()
+	return slices.Clone(catalogue.charges)
+}
+
+// lookup returns the charge with the given name
+func (catalogue *chargeCatalogue) lookup(name string) (charge banCharge, ok bool) {
+	catalogue.lock.RLock()
+	defer catalogue.lock.RUnlock()
+	for _, charge = range catalogue.charges {
+		if charge.Name == name {
+			return charge, true
+		}
+	}
+	return banCharge{}, false
+}
+
+// check removes duplicate charges of a ban and returns the charge that results in the longest ban.
+// Charges are sent as they were typed, unknown charges are reported in err with the closest predefined charge.
+func (catalogue *chargeCatalogue) check(charges []string) (normalized []string, longest banCharge, err error) {
+	var unknown []string
+	for _, name := range charges {
+		if slices.Contains(normalized, name) {
+			continue
+		}
+		normalized = append(normalized, name)
+		charge, ok := catalogue.lookup(name)
+		switch {
+		case ok:
+			if longest.Name == "" || banLength(charge.Hours) > banLength(longest.Hours) {
+				longest = charge
+			}
+		default:
+			if suggestion, found := catalogue.closest(name); found {
+				unknown = append(unknown, fmt.Sprintf("%q, did you mean %q?", name, suggestion))
+			} else {
+				unknown = append(unknown, fmt.Sprintf("%q", name))
+			}
+		}
+	}
+	if len(unknown) > 0 {
+		err = fmt.Errorf("unknown charge %s", strings.Join(unknown, ", "))
+	}
+	return
+}
+
+// closest returns the predefined charge that is most similar to the name, if any is close enough to be a typo.
+// Case is ignored, so a charge with the wrong case is suggested with the right one.
+func (catalogue *chargeCatalogue) closest(name string) (closest string, ok bool) {
+	catalogue.lock.RLock()
+	defer catalogue.lock.RUnlock()
+	name = strings.ToLower(name)
+	best := max(2, len(name)/3) + 1
+	for _, charge := range catalogue.charges {
+		chargeName := strings.ToLower(charge.Name)
+		distance := editDistance(name, chargeName)
+		if strings.HasPrefix(chargeName, name) {
+			// Abbreviations are always a good match
+			distance = 1
+		}
+		if distance < best {
+			closest, best, ok = charge.Name, distance, true
+		}
+	}
+	return
+}
+
+// complete returns all predefined charges that start with the prefix
+func (catalogue *chargeCatalogue) complete(prefix string) (names []string) {
+	catalogue.lock.RLock()
+	defer catalogue.lock.RUnlock()
+	prefix = strings.ToLower(prefix)
+	for _, charge := range catalogue.charges {
+		if strings.HasPrefix(strings.ToLower(charge.Name), prefix) {
+			names = append(names, charge.Name)
+		}
+	}
+	return
+}
+
+// banLength orders ban durations, permanent bans are the longest
+func banLength(hours int) int {
+	if hours == 0 {
+		return math.MaxInt
+	}
+	return hours
+}
+
+// formatBanDuration describes a ban duration in days or hours
+func formatBanDuration(hours int) string {
+	switch {
+	case hours == 0:
+		return "permanent"
+	case hours == 24:
+		return "1 day"
+	case hours%24 == 0:
+		return fmt.Sprintf("%d days", hours/24)
+	case hours == 1:
+		return "1 hour"
+	default:
+		return fmt.Sprintf("%d hours", hours)
+	}
+}
+
+// editDistance is the number of inserted, deleted or replaced characters needed to turn a into b
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+var testCharges = []banCharge{
+	{"cheating", 0, "Cheating"},
+	{"griefing", 24, "Team killing or griefing"},
+	{"spam", 24, "Spamming chat or voice"},
+}
+
+func TestCheckCharges(t *testing.T) {
+	tests := []struct {
+		name       string
+		catalogue  []banCharge
+		charges    []string
+		normalized []string
+		longest    string
+		// err is the expected error, empty if all charges are known
+		err string
+	}{
+		{"known", testCharges, []string{"spam", "cheating"}, []string{"spam", "cheating"}, "cheating", ""},
+		{"duplicates", testCharges, []string{"spam", "spam"}, []string{"spam"}, "spam", ""},
+		{"typo", testCharges, []string{"griefin"}, []string{"griefin"}, "", `unknown charge "griefin", did you mean "griefing"?`},
+		{"case is kept", testCharges, []string{"Spam"}, []string{"Spam"}, "", `unknown charge "Spam", did you mean "spam"?`},
+		{"unrelated", testCharges, []string{"xyz"}, []string{"xyz"}, "", `unknown charge "xyz"`},
+		{"shipped catalogue", shippedCharges, []string{"cheating", "spam"}, []string{"cheating", "spam"}, "cheating", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			catalogue := &chargeCatalogue{charges: test.catalogue}
+			normalized, longest, err := catalogue.check(test.charges)
+			if !slices.Equal(normalized, test.normalized) {
+				t.Errorf("charges = %q, want %q", normalized, test.normalized)
+			}
+			if longest.Name != test.longest {
+				t.Errorf("longest charge = %q, want %q", longest.Name, test.longest)
+			}
+			switch {
+			case test.err == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case test.err != "" && (err == nil || err.Error() != test.err):
+				t.Errorf("error = %v, want %s", err, test.err)
+			}
+		})
+	}
+}
+
+func TestCompleteCharges(t *testing.T) {
+	catalogue := &chargeCatalogue{charges: testCharges}
+	if names := catalogue.complete("G"); !slices.Equal(names, []string{"griefing"}) {
+		t.Errorf("completions = %q, want griefing", names)
+	}
+}
+
+// staticCharges is a backend that answers the ban charges request with a fixed result
+type staticCharges struct {
+	charges []banCharge
+	err     error
+}
+
+func (svc staticCharges) banCharges(ctx context.Context) ([]banCharge, error) {
+	return svc.charges, svc.err
+}
+
+func TestRefreshCharges(t *testing.T) {
+	notFound := &BackendError{StatusCode: http.StatusNotFound, Endpoint: "ban_charges", Err: ErrNotFound}
+	tests := []struct {
+		name string
+		svc  staticCharges
+		want []banCharge
+	}{
+		{"fetched", staticCharges{charges: testCharges}, testCharges},
+		{"no ban charges function", staticCharges{err: notFound}, shippedCharges},
+		{"unavailable", staticCharges{err: &BackendError{StatusCode: http.StatusServiceUnavailable, Endpoint: "ban_charges"}}, shippedCharges},
+		{"empty", staticCharges{}, shippedCharges},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+			catalogue, err := loadChargeCatalogue()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			catalogue.refresh(context.Background(), test.svc)
+			if charges := catalogue.list(); !slices.Equal(charges, test.want) {
+				t.Errorf("charges = %v, want %v", charges, test.want)
+			}
+			// The next start uses the fetched charges
+			catalogue, _ = loadChargeCatalogue()
+			if charges := catalogue.list(); !slices.Equal(charges, test.want) {
+				t.Errorf("charges after restart = %v, want %v", charges, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/charmbracelet/log"
+	"golang.org/x/term"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Exit codes of the subcommands, so scripts can react to the outcome
+const (
+	exitOk = 0
+	// exitError means the command failed, for example because the backend could not be reached
+	exitError = 1
+	// exitUsage means the command line was invalid
+	exitUsage = 2
+	// exitWanted is returned by validate when at least one player is wanted
+	exitWanted = 3
+	// exitUnconfirmed is returned by global actions that needed a confirmation, which was not given
+	exitUnconfirmed = 4
+)
+
+// subcommand is a mode of the tool, selected by the first argument after the flags
+type subcommand struct {
+	name        string
+	args        string
+	description string
+	run         func(ctx context.Context, cfg config, flags *flag.FlagSet, args []string) (exitCode int)
+}
+
+var subcommands = []subcommand{
+	{"watch", "", "validate player lists copied to the clipboard and read console commands (default)", runWatch},
+	{"tui", "", "like watch, but with a full-screen player list", runTui},
+	{"validate", "[flags] [files...]", "validate listplayers dumps from files or stdin and exit", runValidate},
+	{"ban", "[-yes] <playfab-id> <reasons...>", "ban a player globally and print the in-game ban command", runBan},
+	{"unban", "[-yes] <playfab-id>", "remove a player from the global ban list and print the in-game unban command", runUnban},
+	{"trust", "[-yes] <playfab-id> [duration]", "trust a player so they won't show as suspicious", runTrust},
+}
+
+// findSubcommand returns the subcommand with the given name
+func findSubcommand(name string) (cmd subcommand, ok bool) {
+	for _, cmd = range subcommands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return subcommand{}, false
+}
+
+// printUsage describes the global flags and all subcommands
+func printUsage(flags *flag.FlagSet) {
+	out := flags.Output()
+	fmt.Fprintf(out, "Usage: %s [flags] [command] [arguments]\n\nCommands:\n", flags.Name())
+	for _, cmd := range subcommands {
+		fmt.Fprintf(out, "  %-9s %s\n", cmd.name, cmd.description)
+	}
+	fmt.Fprintf(out, "\nExit codes: %d success, %d failure, %d invalid usage, %d wanted players found by validate, %d action not confirmed\n\nFlags:\n",
+		exitOk, exitError, exitUsage, exitWanted, exitUnconfirmed)
+	flags.PrintDefaults()
+}
+
+// newFlags creates the flag set of the subcommand, which the subcommand adds its own flags to
+func (cmd subcommand) newFlags() *flag.FlagSet {
+	flags := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	flags.Usage = func() {
+		out := flags.Output()
+		fmt.Fprintf(out, "Usage: %s %s %s\n\n%s\n", confNamespace, cmd.name, cmd.args, cmd.description)
+		flags.PrintDefaults()
+	}
+	return flags
+}
+
+// parseSubcommand parses the flags of a subcommand and checks the number of remaining arguments.
+// Flags may also follow the arguments, only arguments after "--" are never read as flags.
+// A negative maxArgs allows any number of arguments. If ok is false the subcommand should exit with exitCode.
+func parseSubcommand(flags *flag.FlagSet, args []string, minArgs, maxArgs int) (exitCode int, ok bool) {
+	var positional []string
+	for {
+		err := flags.Parse(args)
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOk, false
+		}
+		if err != nil {
+			return exitUsage, false
+		}
+		remaining := flags.Args()
+		if len(remaining) == 0 {
+			break
+		}
+		if parsed := args[:len(args)-len(remaining)]; len(parsed) > 0 && parsed[len(parsed)-1] == "--" {
+			positional = append(positional, remaining...)
+			break
+		}
+		positional = append(positional, remaining[0])
+		args = remaining[1:]
+	}
+	// Parse again so Args returns the arguments without the flags in between
+	_ = flags.Parse(append([]string{"--"}, positional...))
+	if flags.NArg() < minArgs || (maxArgs >= 0 && flags.NArg() > maxArgs) {
+		fmt.Fprintf(flags.Output(), "wrong number of arguments\n")
+		flags.Usage()
+		return exitUsage, false
+	}
+	return exitOk, true
+}
+
+// checkActionArgs rejects arguments of player actions that look like flags, for example a flag
+// placed after "--", so they are never sent to the backend as a PlayFab ID or charge
+func checkActionArgs(flags *flag.FlagSet) (exitCode int, ok bool) {
+	for _, arg := range flags.Args() {
+		if strings.HasPrefix(arg, "-") {
+			fmt.Fprintf(flags.Output(), "invalid argument %q, flags of the tool go before the command\n", arg)
+			flags.Usage()
+			return exitUsage, false
+		}
+	}
+	return exitOk, true
+}
+
+// runValidate validates the listplayers dumps in files or piped to stdin
+func runValidate(ctx context.Context, cfg config, flags *flag.FlagSet, args []string) (exitCode int) {
+	file := flags.String("file", "", "file with the output of the listplayers command, same as passing it as argument")
+	format := flags.String("format", cfg.OutputFormat, "output format: "+strings.Join(outputFormats, ", "))
+	exitCode, ok := parseSubcommand(flags, args, 0, -1)
+	if !ok {
+		return
+	}
+	if !slices.Contains(outputFormats, *format) {
+		fmt.Fprintf(flags.Output(), "unknown output format %q\n", *format)
+		flags.Usage()
+		return exitUsage
+	}
+	paths := flags.Args()
+	if *file != "" {
+		paths = append([]string{*file}, paths...)
+	}
+	if len(paths) == 0 {
+		if stdinIsTerminal() {
+			fmt.Fprintf(flags.Output(), "validate requires a file or a dump piped to stdin\n")
+			flags.Usage()
+			return exitUsage
+		}
+		paths = []string{"-"}
+	}
+
+	dumps, failed := readDumps(paths)
+	if len(dumps) == 0 {
+		return exitError
+	}
+	svc, credentialPath, err := connectBackend(cfg)
+	if err != nil {
+		log.Error("Validation failed", "err", err)
+		return exitError
+	}
+	trust := loadLocalTrust(cfg, credentialPath)
+
+	reports := make([]validationReport, 0, len(dumps))
+	wanted := false
+	for _, dump := range dumps {
+		serverName, players, err := readPlayerList(dump.text)
+		if err != nil {
+			log.Warn("Failed to read player list", "source", dump.source, "err", err)
+			if len(players) == 0 {
+				failed = true
+				reports = append(reports, newValidationReport(dump.source, serverName, nil, err))
+				continue
+			}
+		}
+		log.Info("Validating players", "source", dump.source, "server", serverName, "count", len(players))
+		validatedPlayers, err := svc.validatePlayers(ctx, serverName, players, true)
+		if err != nil {
+			logError("Failed to validate players", err)
+			failed = true
+			reports = append(reports, newValidationReport(dump.source, serverName, nil, err))
+			continue
+		}
+		trust.apply(validatedPlayers)
+		for _, player := range validatedPlayers {
+			wanted = wanted || player.WantedLevel == "wanted"
+		}
+		reports = append(reports, newValidationReport(dump.source, serverName, validatedPlayers, nil))
+	}
+
+	err = printReports(os.Stdout, *format, reports)
+	if err != nil {
+		log.Error("Failed to print results", "err", err)
+		return exitError
+	}
+	switch {
+	case failed:
+		return exitError
+	case wanted:
+		return exitWanted
+	}
+	return exitOk
+}
+
+// playerListDump is a single listplayers output and where it was read from
+type playerListDump struct {
+	source string
+	text   string
+}
+
+// readDumps reads all listplayers dumps from the files, "-" reads stdin.
+// Files that can't be read are logged and reported by failed.
+func readDumps(paths []string) (dumps []playerListDump, failed bool) {
+	for _, path := range paths {
+		var data []byte
+		var err error
+		source := path
+		if path == "-" {
+			source = "stdin"
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(path)
+		}
+		if err != nil {
+			log.Error("Failed to read player list", "source", source, "err", err)
+			failed = true
+			continue
+		}
+		lists := splitPlayerLists(string(data))
+		if len(lists) == 0 {
+			log.Warn("No player list found", "source", source)
+			failed = true
+		}
+		for _, list := range lists {
+			dumps = append(dumps, playerListDump{source, list})
+		}
+	}
+	return
+}
+
+// stdinIsTerminal reports whether stdin is a console rather than a pipe or file
+func stdinIsTerminal() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// runBan bans a player globally
+func runBan(ctx context.Context, cfg config, flags *flag.FlagSet, args []string) (exitCode int) {
+	yes := flags.Bool("yes", false, "send the ban without asking, even if it needs to be confirmed")
+	exitCode, ok := parseSubcommand(flags, args, 2, -1)
+	if !ok {
+		return
+	}
+	exitCode, ok = checkActionArgs(flags)
+	if !ok {
+		return
+	}
+	return runGlobalAction(ctx, cfg, *yes, func(app *App) pendingAction {
+		return app.banAction(flags.Arg(0), flags.Args()[1:])
+	})
+}
+
+// runUnban removes a player from the global ban list
+func runUnban(ctx context.Context, cfg config, flags *flag.FlagSet, args []string) (exitCode int) {
+	yes := flags.Bool("yes", false, "send the unban without asking, even if it needs to be confirmed")
+	exitCode, ok := parseSubcommand(flags, args, 1, 1)
+	if !ok {
+		return
+	}
+	exitCode, ok = checkActionArgs(flags)
+	if !ok {
+		return
+	}
+	return runGlobalAction(ctx, cfg, *yes, func(app *App) pendingAction {
+		return app.globalAction("unban", flags.Arg(0), nil)
+	})
+}
+
+// runTrust trusts a player on the backend and adds them to the local trust list
+func runTrust(ctx context.Context, cfg config, flags *flag.FlagSet, args []string) (exitCode int) {
+	yes := flags.Bool("yes", false, "send the trust without asking, even if it needs to be confirmed")
+	exitCode, ok := parseSubcommand(flags, args, 1, 2)
+	if !ok {
+		return
+	}
+	exitCode, ok = checkActionArgs(flags)
+	if !ok {
+		return
+	}
+	var duration time.Duration
+	var err error
+	if flags.NArg() == 2 {
+		duration, err = parseTrustDuration(flags.Arg(1))
+		if err != nil {
+			log.Error("Invalid trust duration", "err", err)
+			return exitUsage
+		}
+	}
+	return runGlobalAction(ctx, cfg, *yes, func(app *App) pendingAction {
+		return app.trustAction(flags.Arg(0), "", duration)
+	})
+}
+
+// runGlobalAction sends a global action of the command line through the same checks as console commands.
+// It is recorded in the journal, so it can be undone from the console, and bans are sent to the notifiers.
+// Actions that need a confirmation are confirmed with yes, or on the terminal if stdin is one.
+func runGlobalAction(ctx context.Context, cfg config, yes bool, prepare func(app *App) pendingAction) (exitCode int) {
+	app, err := setupActionApp(ctx, cfg)
+	if err != nil {
+		logError("Action failed", err)
+		return exitError
+	}
+	defer app.notifications.wait()
+
+	pending := prepare(app)
+	outputCommand, err := app.runOrConfirm(ctx, pending)
+	if errors.Is(err, errConfirmationRequired) {
+		app.logPending()
+		if !yes && !confirmOnTerminal() {
+			log.Error("Action was not confirmed, pass -yes to send it anyway")
+			return exitUnconfirmed
+		}
+		outputCommand, err = app.pending.run(ctx)
+	}
+	if errors.Is(err, errDryRun) {
+		return exitOk
+	}
+	if err != nil {
+		logError("Action failed", err)
+		return exitError
+	}
+	if outputCommand != "" {
+		fmt.Println(outputCommand)
+	}
+	return exitOk
+}
+
+// setupActionApp connects to the backend and loads the state that global actions are checked against and recorded in
+func setupActionApp(ctx context.Context, cfg config) (app *App, err error) {
+	svc, credentialPath, err := connectBackend(cfg)
+	if err != nil {
+		return
+	}
+	options := appOptions{
+		confirm:       cfg.ConfirmActions,
+		undoWindow:    time.Duration(cfg.UndoWindow),
+		notifications: newNotificationRouter(cfg),
+		trust:         loadLocalTrust(cfg, credentialPath),
+	}
+	options.charges, err = loadChargeCatalogue()
+	if err != nil {
+		log.Warn("Failed to load ban charges, using the shipped charges", "err", err)
+	}
+	options.charges.refresh(ctx, svc)
+	options.journal, err = loadActionJournal(options.undoWindow)
+	if err != nil {
+		log.Warn("Failed to load the journal, starting with an empty journal", "err", err)
+	}
+	return newApp(actionService(cfg, svc), nil, nil, nil, os.Stdout, options), nil
+}
+
+// confirmOnTerminal asks the admin to confirm an action, if stdin is a terminal
+func confirmOnTerminal() bool {
+	if !stdinIsTerminal() {
+		return false
+	}
+	fmt.Fprint(os.Stderr, "Type yes to send it: ")
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	return strings.TrimSpace(answer) == "yes"
+}
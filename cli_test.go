@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testConfig points the config at a test backend without authentication
+func testConfig(t *testing.T, backend http.Handler) config {
+	t.Helper()
+	server := httptest.NewServer(backend)
+	t.Cleanup(server.Close)
+	cfg := defaultConfig
+	cfg.BackendUrl = server.URL
+	cfg.AuthMode = authNone
+	cfg.MaxRetries = 0
+	return cfg
+}
+
+// testFlags creates the flags of a subcommand that don't print usage
+func testFlags(name string) *flag.FlagSet {
+	cmd, _ := findSubcommand(name)
+	flags := cmd.newFlags()
+	flags.SetOutput(io.Discard)
+	return flags
+}
+
+func TestParseSubcommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		exitCode int
+		ok       bool
+		// file is the value of the file flag
+		file string
+		rest []string
+	}{
+		{"arguments", []string{"a", "b"}, exitOk, true, "", []string{"a", "b"}},
+		{"flag first", []string{"-file", "f", "a"}, exitOk, true, "f", []string{"a"}},
+		{"flag last", []string{"a", "-file", "f"}, exitOk, true, "f", []string{"a"}},
+		{"flag between", []string{"a", "-file=f", "b"}, exitOk, true, "f", []string{"a", "b"}},
+		{"stdin", []string{"-", "-file", "f"}, exitOk, true, "f", []string{"-"}},
+		{"after double dash", []string{"a", "--", "-file", "f"}, exitOk, true, "", []string{"a", "-file", "f"}},
+		{"unknown flag last", []string{"a", "--dry-run"}, exitUsage, false, "", nil},
+		{"help", []string{"a", "-h"}, exitOk, false, "", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			flags := testFlags("validate")
+			file := flags.String("file", "", "")
+			exitCode, ok := parseSubcommand(flags, test.args, 0, -1)
+			if exitCode != test.exitCode || ok != test.ok {
+				t.Fatalf("parseSubcommand = %d, %v, want %d, %v", exitCode, ok, test.exitCode, test.ok)
+			}
+			if !ok {
+				return
+			}
+			if *file != test.file || !slices.Equal(flags.Args(), test.rest) {
+				t.Errorf("file = %q, args = %q, want %q and %q", *file, flags.Args(), test.file, test.rest)
+			}
+		})
+	}
+}
+
+func TestActionFlagsAreNoArguments(t *testing.T) {
+	tests := []struct {
+		command string
+		args    []string
+	}{
+		{"ban", []string{"AAAA000000000001", "cheating", "--dry-run"}},
+		{"ban", []string{"AAAA000000000001", "--", "cheating", "-dry-run"}},
+		{"ban", []string{"--", "-AAAA000000000001", "cheating"}},
+		{"unban", []string{"AAAA000000000001", "-dry-run"}},
+		{"trust", []string{"--", "AAAA000000000001", "-7d"}},
+	}
+	for _, test := range tests {
+		t.Run(test.command, func(t *testing.T) {
+			backend := newTestBackend()
+			cfg := testConfig(t, backend)
+			cmd, _ := findSubcommand(test.command)
+			exitCode := cmd.run(context.Background(), cfg, testFlags(test.command), test.args)
+			if exitCode != exitUsage {
+				t.Errorf("exit code = %d, want %d", exitCode, exitUsage)
+			}
+			if len(backend.Actions()) != 0 {
+				t.Errorf("player actions = %q, want none", backend.Actions())
+			}
+		})
+	}
+}
+
+func TestGlobalActionCommands(t *testing.T) {
+	tests := []struct {
+		name     string
+		command  string
+		args     []string
+		confirm  confirmPolicy
+		exitCode int
+		actions  []string
+		// journal are the actions that must be recorded in the journal
+		journal []string
+		// notified is set if the ban must be sent to the webhook
+		notified bool
+	}{
+		{"ban needs confirmation", "ban", []string{"AAAA000000000001", "spam"}, confirmBans, exitUnconfirmed, nil, nil, false},
+		{"ban is confirmed", "ban", []string{"-yes", "AAAA000000000001", "spam"}, confirmBans, exitOk,
+			[]string{"ban AAAA000000000001 spam"}, []string{"ban"}, true},
+		{"ban without confirmation", "ban", []string{"AAAA000000000001", "spam"}, confirmNever, exitOk,
+			[]string{"ban AAAA000000000001 spam"}, []string{"ban"}, true},
+		{"unknown charge needs confirmation", "ban", []string{"AAAA000000000001", "spm"}, confirmNever, exitUnconfirmed, nil, nil, false},
+		{"unknown charge is confirmed", "ban", []string{"AAAA000000000001", "spm", "-yes"}, confirmNever, exitOk,
+			[]string{"ban AAAA000000000001 spm"}, []string{"ban"}, true},
+		{"unban", "unban", []string{"AAAA000000000001"}, confirmBans, exitOk, []string{"unban AAAA000000000001"}, []string{"unban"}, false},
+		{"trust needs confirmation", "trust", []string{"AAAA000000000001"}, confirmAlways, exitUnconfirmed, nil, nil, false},
+		{"trust", "trust", []string{"AAAA000000000001", "7d"}, confirmBans, exitOk, []string{"trust AAAA000000000001"}, []string{"trust"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+			err := saveJson(chargesFileName, testCharges)
+			if err != nil {
+				t.Fatal(err)
+			}
+			backend := newTestBackend()
+			cfg := testConfig(t, backend)
+			cfg.ConfirmActions = test.confirm
+			url, body := webhookServer(t, http.StatusNoContent)
+			cfg.WebhookUrl = url
+			cfg.Notify = map[string][]string{eventBan: {"webhook"}}
+
+			cmd, _ := findSubcommand(test.command)
+			exitCode := cmd.run(context.Background(), cfg, testFlags(test.command), test.args)
+			if exitCode != test.exitCode {
+				t.Errorf("exit code = %d, want %d", exitCode, test.exitCode)
+			}
+			if !slices.Equal(backend.Actions(), test.actions) {
+				t.Errorf("player actions = %q, want %q", backend.Actions(), test.actions)
+			}
+			journal, err := loadActionJournal(time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var recorded []string
+			for _, entry := range journal.list() {
+				recorded = append(recorded, entry.Action)
+			}
+			if !slices.Equal(recorded, test.journal) {
+				t.Errorf("journal = %q, want %q", recorded, test.journal)
+			}
+			if test.notified && !strings.Contains(string(body()), "AAAA000000000001") {
+				t.Errorf("the webhook was not told about the ban")
+			}
+		})
+	}
+}
+
+func TestUndoCommandLineBan(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	backend := newTestBackend()
+	cfg := testConfig(t, backend)
+	cmd, _ := findSubcommand("ban")
+	if exitCode := cmd.run(context.Background(), cfg, testFlags("ban"), []string{"-yes", "AAAA000000000001", "spam"}); exitCode != exitOk {
+		t.Fatalf("exit code = %d, want %d", exitCode, exitOk)
+	}
+
+	// A running session picks up the ban from the saved journal
+	journal, err := loadActionJournal(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := appOptions{confirm: confirmNever, journal: journal}
+	app := newApp(newTestService(t, backend), nil, nil, nil, io.Discard, options)
+	_, err = app.executeCommand(context.Background(), "undo")
+	if err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	if want := []string{"ban AAAA000000000001 spam", "unban AAAA000000000001"}; !slices.Equal(backend.Actions(), want) {
+		t.Errorf("player actions = %q, want %q", backend.Actions(), want)
+	}
+	entries := journal.list()
+	if len(entries) != 2 || !entries[0].Undone || entries[1].UndoOf != entries[0].Number {
+		t.Errorf("journal = %+v, want the ban marked as undone by the unban", entries)
+	}
+}
+
+func TestValidateExitCodes(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	dir := t.TempDir()
+	writeDump := func(name, text string) string {
+		path := filepath.Join(dir, name)
+		err := os.WriteFile(path, []byte(text), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	wanted := writeDump("wanted.txt", testDump)
+	clean := writeDump("clean.txt", strings.Replace(testDump, "Alice - Smith - AAAA000000000002 - eos2 - 115 - 11 - 1\n", "", 1))
+	empty := writeDump("empty.txt", "nothing to see here\n")
+	missing := filepath.Join(dir, "missing.txt")
+	down := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "backend is down", http.StatusInternalServerError)
+	})
+
+	tests := []struct {
+		name     string
+		backend  http.Handler
+		args     []string
+		exitCode int
+	}{
+		{"clean", newTestBackend(), []string{clean}, exitOk},
+		{"wanted", newTestBackend(), []string{clean, wanted}, exitWanted},
+		{"missing file", newTestBackend(), []string{missing}, exitError},
+		{"no player list", newTestBackend(), []string{empty}, exitError},
+		// A failure is reported even if a wanted player was found, since the results are incomplete
+		{"wanted and missing file", newTestBackend(), []string{wanted, missing}, exitError},
+		{"backend down", down, []string{clean}, exitError},
+		{"unknown format", newTestBackend(), []string{"-format", "xml", clean}, exitUsage},
+		{"unknown flag", newTestBackend(), []string{clean, "-yes"}, exitUsage},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := testConfig(t, test.backend)
+			exitCode := runValidate(context.Background(), cfg, testFlags("validate"), append([]string{"-format", "jsonl"}, test.args...))
+			if exitCode != test.exitCode {
+				t.Errorf("exit code = %d, want %d", exitCode, test.exitCode)
+			}
+		})
+	}
+}
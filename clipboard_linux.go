@@ -0,0 +1,173 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// clipboardPollInterval is longer than on Windows, since every poll starts a selection tool process
+// unless wl-paste watches the clipboard
+const clipboardPollInterval = 250 * time.Millisecond
+
+// selectionTool describes a command line program that can read and write the clipboard selection
+type selectionTool struct {
+	name  string
+	read  []string
+	write []string
+	// timestamp prints the time the current selection owner acquired the clipboard, if supported
+	timestamp []string
+	// watch runs until killed and prints a line every time the clipboard changes, if supported
+	watch []string
+}
+
+var (
+	wlClipboard = selectionTool{
+		name:  "wl-paste",
+		read:  []string{"wl-paste", "--no-newline", "--type", "text"},
+		write: []string{"wl-copy", "--type", "text/plain"},
+		watch: []string{"wl-paste", "--type", "text", "--watch", "echo"},
+	}
+	xclipClipboard = selectionTool{
+		name:      "xclip",
+		read:      []string{"xclip", "-selection", "clipboard", "-out"},
+		write:     []string{"xclip", "-selection", "clipboard", "-in"},
+		timestamp: []string{"xclip", "-selection", "clipboard", "-target", "TIMESTAMP", "-out"},
+	}
+	xselClipboard = selectionTool{
+		name:  "xsel",
+		read:  []string{"xsel", "--clipboard", "--output"},
+		write: []string{"xsel", "--clipboard", "--input"},
+	}
+)
+
+// linuxClipboard accesses the X11 or Wayland clipboard through external selection tools
+type linuxClipboard struct {
+	tool     selectionTool
+	watching bool
+	changes  atomic.Uint64
+
+	hashLock sync.Mutex
+	lastHash uint64
+}
+
+// newClipboardBackend returns the clipboard backend for the current platform.
+// Processes it keeps running in the background are stopped when the context is done.
+func newClipboardBackend(ctx context.Context) (ClipboardBackend, error) {
+	candidates := make([]selectionTool, 0, 3)
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		candidates = append(candidates, wlClipboard)
+	}
+	if os.Getenv("DISPLAY") != "" {
+		candidates = append(candidates, xclipClipboard, xselClipboard)
+	}
+	if len(candidates) == 0 {
+		return nil, errors.New("no graphical session found, neither WAYLAND_DISPLAY nor DISPLAY is set")
+	}
+	for _, tool := range candidates {
+		_, err := exec.LookPath(tool.read[0])
+		if err != nil {
+			continue
+		}
+		_, err = exec.LookPath(tool.write[0])
+		if err != nil {
+			continue
+		}
+		clipboard := &linuxClipboard{tool: tool}
+		clipboard.startWatcher(ctx)
+		return clipboard, nil
+	}
+	return nil, errors.New("no clipboard tool found, install wl-clipboard, xclip or xsel")
+}
+
+// startWatcher runs the watch command of the selection tool in the background until the context is done, if it has one.
+// Every line it prints counts as a clipboard change.
+func (c *linuxClipboard) startWatcher(ctx context.Context) {
+	if len(c.tool.watch) == 0 {
+		return
+	}
+	cmd := exec.CommandContext(ctx, c.tool.watch[0], c.tool.watch[1:]...)
+	// The context might not be noticed before the helper exits, so the watcher is also killed with the helper
+	cmd.SysProcAttr = &syscall.SysProcAttr{Pdeathsig: syscall.SIGKILL}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return
+	}
+	err = cmd.Start()
+	if err != nil {
+		return
+	}
+	c.watching = true
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			c.changes.Add(1)
+		}
+		// The watcher died, fall back to comparing the clipboard contents
+		_ = cmd.Wait()
+		c.hashLock.Lock()
+		c.watching = false
+		c.hashLock.Unlock()
+	}()
+}
+
+// ChangeCount prefers the selection timestamp or the watcher to detect changes like GetClipboardSequenceNumber does.
+// If the tool supports neither, the clipboard contents are compared, which misses copies of identical text.
+func (c *linuxClipboard) ChangeCount() uint64 {
+	if len(c.tool.timestamp) > 0 {
+		output, err := exec.Command(c.tool.timestamp[0], c.tool.timestamp[1:]...).Output()
+		if err == nil {
+			timestamp, err := strconv.ParseUint(strings.TrimSpace(string(output)), 10, 64)
+			if err == nil {
+				return timestamp
+			}
+		}
+	}
+
+	c.hashLock.Lock()
+	defer c.hashLock.Unlock()
+	if c.watching {
+		return c.changes.Load()
+	}
+	data, _ := c.ReadString()
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(data))
+	if sum := hash.Sum64(); sum != c.lastHash {
+		c.lastHash = sum
+		c.changes.Add(1)
+	}
+	return c.changes.Load()
+}
+
+func (c *linuxClipboard) ReadString() (data string, err error) {
+	output, err := exec.Command(c.tool.read[0], c.tool.read[1:]...).Output()
+	if err != nil {
+		// The selection tools fail when the clipboard is empty or holds no text
+		return "", nil
+	}
+	return string(output), nil
+}
+
+func (c *linuxClipboard) WriteString(data string) error {
+	cmd := exec.Command(c.tool.write[0], c.tool.write[1:]...)
+	cmd.Stdin = strings.NewReader(data)
+	// Output is not captured because the tools fork a child that keeps serving the selection,
+	// which would otherwise hold the pipes open until another program takes over the clipboard
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("%s failed to write clipboard: %w", c.tool.name, err)
+	}
+	return nil
+}
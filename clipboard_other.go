@@ -0,0 +1,17 @@
+//go:build !windows && !linux
+
+package main
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"time"
+)
+
+const clipboardPollInterval = 50 * time.Millisecond
+
+// newClipboardBackend returns the clipboard backend for the current platform
+func newClipboardBackend(ctx context.Context) (ClipboardBackend, error) {
+	return nil, errors.New("clipboard access is not supported on " + runtime.GOOS)
+}
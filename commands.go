@@ -7,35 +7,231 @@ import (
 	"fmt"
 	"github.com/charmbracelet/log"
 	"io"
-	"os"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 )
 
-var localTrustList = make([]string, 0)
-
-// watchStdin monitors console input and notifies the channel when a new command is received
-func watchStdin(ctx context.Context) (events chan string) {
+// watchStdin monitors console input and notifies the channel when a new command is received.
+// The channel is closed when the input ends or can't be read anymore.
+func watchStdin(ctx context.Context, input io.Reader) (events chan string) {
 	events = make(chan string)
-	stdin := bufio.NewReader(os.Stdin)
+	reader := bufio.NewReader(input)
 	go func() {
+		defer close(events)
 		for {
-			if ctx.Err() != nil {
-				close(events)
-				return
-			}
-			command, _ := stdin.ReadString('\n')
+			command, err := reader.ReadString('\n')
 			command = strings.TrimSpace(command)
-			if command == "" {
-				continue
+			if command != "" {
+				select {
+				case events <- command:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err != nil {
+				if !errors.Is(err, io.EOF) {
+					log.Warn("Failed to read commands", "err", err)
+				}
+				return
 			}
-			events <- command
 		}
 	}()
 	return
 }
 
-func executeCommand(command string, players []validatedPlayer, svc backendService) (outputCommand string, err error) {
+// completionKind is what an argument of a console command is completed with
+type completionKind int
+
+const (
+	completeNothing completionKind = iota
+	completePlayers
+	completeCharges
+	completeFormats
+	completeServers
+)
+
+// consoleCommand describes a console command for the help and tab completion
+type consoleCommand struct {
+	name        string
+	args        string
+	description string
+	// first is how the first argument is completed, rest how all further arguments are completed
+	first, rest completionKind
+}
+
+var consoleCommands = []consoleCommand{
+	{"kick", "<player-number>", "copy a kick command for the player", completePlayers, completeNothing},
+	{"ban", "<player-number> <reasons...>", "ban the player on every SAK server", completePlayers, completeCharges},
+	{"banbyid", "<playfab-id> <reasons...>", "ban a player that is not in the lobby", completeNothing, completeCharges},
+	{"unbanbyid", "<playfab-id>", "remove a player from the global ban list", completeNothing, completeNothing},
+	{"trust", "<player-number> [duration]", "trust the player so they won't show as suspicious", completePlayers, completeNothing},
+	{"untrust", "<player-number|playfab-id>", "revoke the trust of a player", completePlayers, completeNothing},
+	{"listtrusted", "", "show the players that were trusted from this client", completeNothing, completeNothing},
+	{"diff", "", "show who joined, left or was renamed since the previous scan", completeNothing, completeNothing},
+	{"charges", "", "show the predefined ban reasons", completeNothing, completeNothing},
+	{"journal", "", "show the recent global actions sent from this client", completeNothing, completeNothing},
+	{"undo", "[entry-number]", "revert your latest or the given global action", completeNothing, completeNothing},
+	{"confirm", "", "execute the command that is waiting for confirmation", completeNothing, completeNothing},
+	{"syncstatus", "", "show the state of the local wanted board mirror", completeNothing, completeNothing},
+	{"format", "[name]", "show or switch the output format", completeFormats, completeNothing},
+	{"lookup", "<playfab-id|name|alias>", "search the player records of the backend", completeNothing, completeNothing},
+	{"alerts", "", "list the wanted and suspicious players that were not acknowledged yet", completeNothing, completeNothing},
+	{"ack", "[alert-number]", "dismiss one or all pending alerts", completeNothing, completeNothing},
+	{"servers", "", "list the servers that were scanned in this session", completeNothing, completeNothing},
+	{"use", "<server-number|name>", "make commands refer to the players of another server", completeServers, completeNothing},
+	{"help", "", "list all commands", completeNothing, completeNothing},
+}
+
+// completeCommand returns the candidates for the word at the end of a command line, which starts at start.
+// It is called while the command is typed, so it only uses state that is safe to read concurrently.
+func (app *App) completeCommand(line string) (start int, candidates []completion) {
+	start = strings.LastIndex(line, " ") + 1
+	word := line[start:]
+	fields := strings.Fields(line[:start])
+	if len(fields) == 0 {
+		for _, cmd := range consoleCommands {
+			if strings.HasPrefix(cmd.name, word) {
+				candidates = append(candidates, completion{cmd.name, strings.TrimSpace(cmd.name + " " + cmd.args)})
+			}
+		}
+		return
+	}
+	i := slices.IndexFunc(consoleCommands, func(cmd consoleCommand) bool { return cmd.name == fields[0] })
+	if i < 0 {
+		return
+	}
+	kind := consoleCommands[i].first
+	if len(fields) > 1 {
+		kind = consoleCommands[i].rest
+	}
+	state := app.completion.Load()
+	if state == nil {
+		state = &completionState{}
+	}
+	switch kind {
+	case completePlayers:
+		// Players can be picked by number or by typing the start of their name
+		for _, player := range state.players {
+			number := strconv.Itoa(player.Number)
+			if strings.HasPrefix(number, word) || (word != "" && strings.HasPrefix(strings.ToLower(player.DisplayName), strings.ToLower(word))) {
+				candidates = append(candidates, completion{number, number + " " + player.DisplayName})
+			}
+		}
+	case completeCharges:
+		for _, name := range app.charges.complete(word) {
+			candidates = append(candidates, completion{name, name})
+		}
+	case completeFormats:
+		for _, format := range outputFormats {
+			if strings.HasPrefix(format, word) {
+				candidates = append(candidates, completion{format, format})
+			}
+		}
+	case completeServers:
+		// Server names contain spaces, so servers are completed by their number
+		for i, name := range state.servers {
+			number := strconv.Itoa(i + 1)
+			if strings.HasPrefix(number, word) || (word != "" && strings.HasPrefix(strings.ToLower(name), strings.ToLower(word))) {
+				candidates = append(candidates, completion{number, number + " " + name})
+			}
+		}
+	}
+	return
+}
+
+// errConfirmationRequired is returned for actions that are only executed once the admin confirms them
+var errConfirmationRequired = errors.New("confirmation required")
+
+// pendingAction is a command whose target and parameters were resolved completely.
+// If it needs a confirmation, confirming runs exactly the action that was shown to the admin.
+type pendingAction struct {
+	// action is the global action that is sent, empty for commands that only affect this client
+	action string
+	// summary names the action, its target by display name and PlayFab ID and the charges of bans
+	summary string
+	// checks are the reasons why the action has to be confirmed, besides the confirm policy
+	checks []string
+	run    func(ctx context.Context) (outputCommand string, err error)
+}
+
+// then runs f once the action succeeded, for local follow-ups like updating the trust list
+func (pending pendingAction) then(f func() error) pendingAction {
+	run := pending.run
+	pending.run = func(ctx context.Context) (outputCommand string, err error) {
+		outputCommand, err = run(ctx)
+		if err != nil {
+			return
+		}
+		err = f()
+		return
+	}
+	return pending
+}
+
+// runOrConfirm runs the action right away, unless a check or the confirm policy wants it confirmed.
+// In that case it is kept until the admin confirms it and errConfirmationRequired is returned.
+func (app *App) runOrConfirm(ctx context.Context, pending pendingAction) (outputCommand string, err error) {
+	pending.checks = slices.DeleteFunc(pending.checks, func(check string) bool { return check == "" })
+	if len(pending.checks) == 0 && (pending.action == "" || !app.confirm.requires(pending.action)) {
+		return pending.run(ctx)
+	}
+	app.pending = &pending
+	return "", errConfirmationRequired
+}
+
+// globalAction prepares a global action for a player, checks are reasons to confirm it
+func (app *App) globalAction(action, playfabId string, params map[string]any, checks ...string) pendingAction {
+	summary := action + " " + app.describePlayer(playfabId) + " on every SAK server"
+	if charges, ok := params["charges"].([]string); ok {
+		summary += " for " + strings.Join(charges, ", ")
+		if _, longest, _ := app.charges.check(charges); longest.Name != "" {
+			summary += " (" + formatBanDuration(longest.Hours) + ")"
+		}
+	}
+	return pendingAction{
+		action:  action,
+		summary: summary,
+		checks:  checks,
+		run: func(ctx context.Context) (outputCommand string, err error) {
+			log.Info("Sending global action", "action", summary)
+			return app.sendAction(ctx, action, playfabId, params)
+		},
+	}
+}
+
+// banAction prepares a global ban. Charges that are not predefined have to be confirmed.
+func (app *App) banAction(playfabId string, charges []string, checks ...string) pendingAction {
+	charges, chargeCheck := app.checkCharges(charges)
+	return app.globalAction("ban", playfabId, map[string]any{
+		"charges": charges,
+	}, append(checks, chargeCheck)...)
+}
+
+// trustAction prepares trusting a player globally, who is also trusted on this client right away
+func (app *App) trustAction(playfabId, displayName string, duration time.Duration, checks ...string) pendingAction {
+	return app.globalAction("trust", playfabId, nil, checks...).then(func() error {
+		log.Info("This action may take up to 15 minutes to apply globally")
+		// Mark the player trusted on this client immediately
+		err := app.trust.add(playfabId, displayName, duration)
+		if err != nil {
+			return fmt.Errorf("player was trusted but the local trust list could not be saved: %w", err)
+		}
+		for _, session := range app.sessions {
+			app.trust.apply(session.players)
+		}
+		return nil
+	})
+}
+
+// executeCommand runs a console command against the current player table.
+// Commands may result in an in-game command that should be copied to the clipboard.
+// Actions that could hit the wrong player or are not allowed by the confirm policy
+// fail with errConfirmationRequired and are kept in app.pending.
+func (app *App) executeCommand(ctx context.Context, command string) (outputCommand string, err error) {
+	players := app.session.players
+
 	// Parse command and arguments
 	rd := strings.NewReader(command)
 	args := make([]string, 0, 2)
@@ -48,61 +244,369 @@ func executeCommand(command string, players []validatedPlayer, svc backendServic
 			args = append(args, arg)
 		}
 	}
-	if !errors.Is(err, io.EOF) || len(args) < 2 {
+	if !errors.Is(err, io.EOF) || len(args) < 1 {
 		err = errors.New("invalid command format")
 		return
 	}
-	index, err := strconv.Atoi(args[1])
-	if err != nil || index < 0 || index >= len(players) {
-		index = -1
-	}
 	err = nil
+	// target is the player the player number in the first argument refers to,
+	// targetCheck asks for a confirmation if the player is no longer in the current table
+	var target validatedPlayer
+	var targetCheck string
+	var targetErr error
+	if len(args) >= 2 {
+		target, targetCheck, targetErr = app.playerByNumber(args[1])
+	} else {
+		targetErr = errors.New("missing player number")
+	}
 
 	// Execute command
 	switch args[0] {
 	case "kick":
 		// Generate a one time kick command
-		if index == -1 {
-			err = errors.New("invalid player number")
+		if targetErr != nil {
+			err = targetErr
 			break
 		}
-		outputCommand = "kickbyid " + players[index].PlayfabId
+		outputCommand, err = app.runOrConfirm(ctx, pendingAction{
+			summary: "kick " + app.describePlayer(target.PlayfabId),
+			checks:  []string{targetCheck},
+			run: func(ctx context.Context) (string, error) {
+				app.alerts.acknowledgePlayer(target.PlayfabId)
+				return "kickbyid " + target.PlayfabId, nil
+			},
+		})
 	case "ban":
 		// Ban a player globally
-		if index == -1 {
-			err = errors.New("invalid player number")
+		if targetErr != nil {
+			err = targetErr
 			break
 		}
 		if len(args) < 3 {
 			err = errors.New("ban requires at least 1 reason")
 			break
 		}
-		outputCommand, err = svc.playerAction("ban", players[index].PlayfabId, map[string]any{
-			"charges": args[2:],
-		})
+		outputCommand, err = app.runOrConfirm(ctx, app.banAction(target.PlayfabId, args[2:], targetCheck))
 	case "banbyid":
 		// Ban a player that is not currently in the lobby
 		if len(args) < 3 {
 			err = errors.New("banbyid requires at least 1 reason")
 			break
 		}
-		outputCommand, err = svc.playerAction("ban", args[1], map[string]any{
-			"charges": args[2:],
-		})
+		outputCommand, err = app.runOrConfirm(ctx, app.banAction(args[1], args[2:]))
 	case "unbanbyid":
-		outputCommand, err = svc.playerAction("unban", args[1], nil)
+		if len(args) < 2 {
+			err = errors.New("unbanbyid requires a PlayFab ID")
+			break
+		}
+		outputCommand, err = app.runOrConfirm(ctx, app.globalAction("unban", args[1], nil))
 	case "trust":
 		// Trust a player so they won't show as suspicious
-		if index == -1 {
-			err = errors.New("invalid player number")
+		if targetErr != nil {
+			err = targetErr
 			break
 		}
-		_, err = svc.playerAction("trust", players[index].PlayfabId, nil)
-		log.Info("This action may take up to 15 minutes to apply globally")
-		// Mark the player trusted on this client immediately
-		localTrustList = append(localTrustList, players[index].PlayfabId)
+		var duration time.Duration
+		if len(args) >= 3 {
+			duration, err = parseTrustDuration(args[2])
+			if err != nil {
+				break
+			}
+		}
+		trust := app.trustAction(target.PlayfabId, target.DisplayName, duration, targetCheck)
+		_, err = app.runOrConfirm(ctx, trust)
+	case "untrust":
+		// Revoke the trust of a player, by player number or PlayFab ID
+		if len(args) < 2 {
+			err = errors.New("untrust requires a player number or PlayFab ID")
+			break
+		}
+		playfabId := args[1]
+		if targetErr == nil {
+			playfabId = target.PlayfabId
+		} else {
+			targetCheck = ""
+		}
+		untrust := app.globalAction("untrust", playfabId, nil, targetCheck).then(func() error {
+			removed, err := app.trust.remove(playfabId)
+			if err != nil {
+				return fmt.Errorf("player was untrusted but the local trust list could not be saved: %w", err)
+			}
+			if !removed {
+				log.Info("Player was not on the local trust list, only the backend was updated")
+			}
+			log.Info("This action may take up to 15 minutes to apply globally")
+			return nil
+		})
+		_, err = app.runOrConfirm(ctx, untrust)
+	case "undo":
+		// Revert a recent global action by sending its inverse
+		number := 0
+		if len(args) >= 2 {
+			number, err = strconv.Atoi(args[1])
+			if err != nil {
+				err = errors.New("invalid journal entry number")
+				break
+			}
+		}
+		var entry journalEntry
+		entry, err = app.journal.undoable(number)
+		if err != nil {
+			break
+		}
+		action, params, inverseErr := entry.inverse()
+		if inverseErr != nil {
+			err = inverseErr
+			break
+		}
+		undo := app.globalAction(action, entry.PlayfabId, params).then(func() (err error) {
+			err = app.journal.markUndone(entry.Number, action)
+			if err != nil {
+				log.Warn("Failed to mark the action as undone in the journal", "err", err)
+			}
+			log.Info("Action was undone", "action", entry.Action, "player", entry.DisplayName, "id", entry.PlayfabId)
+			// Keep the local trust list in line with the backend
+			switch action {
+			case "untrust":
+				log.Info("This action may take up to 15 minutes to apply globally")
+				_, err = app.trust.remove(entry.PlayfabId)
+			case "trust":
+				log.Info("This action may take up to 15 minutes to apply globally")
+				var duration time.Duration
+				if entry.ExpiresAt != nil {
+					duration = max(time.Until(*entry.ExpiresAt), time.Second)
+				}
+				err = app.trust.add(entry.PlayfabId, entry.DisplayName, duration)
+			}
+			if err != nil {
+				err = fmt.Errorf("action was undone but the local trust list could not be saved: %w", err)
+			}
+			return
+		})
+		outputCommand, err = app.runOrConfirm(ctx, undo)
+	case "journal":
+		// Show the recent global actions of this client
+		printJournal(app.out, app.journal.list(), app.journal.window)
+	case "listtrusted":
+		// Show every player that was trusted from this client
+		printTrustList(app.out, app.trust.list())
+	case "diff":
+		// Show who joined, left or changed their name since the previous scan of the server
+		if !app.session.hasDiff() {
+			err = errors.New("there is no previous scan of this server to compare with")
+			break
+		}
+		printDiff(app.out, app.session.diff)
+	case "lookup":
+		// Search the backend for players who don't have to be in the lobby
+		if len(args) < 2 {
+			err = errors.New("lookup requires a PlayFab ID, display name or alias")
+			break
+		}
+		query := strings.Join(args[1:], " ")
+		var found []validatedPlayer
+		found, err = app.lookupPlayers(ctx, query)
+		if err != nil {
+			break
+		}
+		if len(found) == 0 {
+			log.Info("No player found", "query", query)
+			break
+		}
+		app.trust.apply(found)
+		printPlayerRecords(app.out, found)
+	case "alerts":
+		// Show the wanted and suspicious players that were not acknowledged yet
+		printAlerts(app.out, app.alerts.list())
+	case "ack":
+		// Dismiss one or all pending alerts
+		number := 0
+		if len(args) >= 2 {
+			number, err = strconv.Atoi(args[1])
+			if err != nil {
+				err = errors.New("invalid alert number")
+				break
+			}
+		}
+		var count int
+		count, err = app.alerts.acknowledge(number)
+		if err != nil {
+			break
+		}
+		log.Info("Alerts were acknowledged", "count", count)
+	case "servers":
+		// Show every server of this session, commands refer to the current one
+		printServers(app.out, app.sessions, app.session)
+	case "use":
+		// Make commands refer to another server
+		if len(args) < 2 {
+			err = errors.New("use requires a server number or name")
+			break
+		}
+		var session *serverSession
+		session, err = app.findSession(strings.Join(args[1:], " "))
+		if err != nil {
+			break
+		}
+		app.switchSession(session)
+		if len(session.players) > 0 {
+			app.printPlayers()
+		}
+	case "help":
+		printHelp(app.out, consoleCommands)
+	case "charges":
+		// Show the predefined ban charges
+		printCharges(app.out, app.charges.list())
+	case "syncstatus":
+		// Show the state of the local wanted board mirror
+		if app.wantedBoard == nil {
+			err = errors.New("the wanted board mirror is disabled")
+			break
+		}
+		entries, lastSync, cursor, lastErr := app.wantedBoard.status()
+		if lastSync.IsZero() {
+			log.Info("Wanted board has not been synced yet", "err", lastErr)
+			break
+		}
+		log.Info("Wanted board status", "entries", entries, "synced", formatAge(time.Since(lastSync))+" ago", "cursor", cursor)
+		if lastErr != nil {
+			log.Warn("Last sync failed", "err", lastErr)
+		}
+	case "format":
+		// Switch the output format of the player table and print the current table again
+		if len(args) < 2 {
+			log.Info("Output format", "format", app.format, "available", strings.Join(outputFormats, ", "))
+			break
+		}
+		if !slices.Contains(outputFormats, args[1]) {
+			err = fmt.Errorf("unknown output format %q, use one of %s", args[1], strings.Join(outputFormats, ", "))
+			break
+		}
+		app.format = args[1]
+		if len(players) > 0 {
+			app.printPlayers()
+		}
 	default:
-		err = errors.New("command not recognized")
+		err = errors.New("command not recognized, type help to list all commands")
 	}
 	return
 }
+
+// playerByNumber returns the player that a player number refers to. Players that are no longer
+// in the current table might have been mixed up with someone else, so check asks for a confirmation.
+func (app *App) playerByNumber(arg string) (player validatedPlayer, check string, err error) {
+	number, err := strconv.Atoi(arg)
+	if err != nil {
+		return player, "", errors.New("invalid player number")
+	}
+	for _, player = range app.session.players {
+		if player.Number == number {
+			return player, "", nil
+		}
+	}
+	player, ok := app.session.numbers.lookup(number)
+	if !ok {
+		return player, "", errors.New("invalid player number")
+	}
+	check = fmt.Sprintf("player %d (%s) is not in the current player list", number, player.DisplayName)
+	return
+}
+
+// sendAction sends a global action to the backend and records it in the journal
+func (app *App) sendAction(ctx context.Context, action, playfabId string, params map[string]any) (outputCommand string, err error) {
+	outputCommand, err = app.svc.playerAction(ctx, action, playfabId, params)
+	if err != nil {
+		return
+	}
+	player, _ := app.findPlayer(playfabId)
+	charges, _ := params["charges"].([]string)
+	var expiresAt *time.Time
+	switch action {
+	case "unban":
+		// Remember why the player was wanted, so the unban can be undone
+		charges = player.WantedFor
+	case "untrust":
+		// Remember when the trust would have run out, so undoing the untrust doesn't trust the player for ever
+		expiresAt = app.trust.entries[playfabId].ExpiresAt
+	}
+	err = app.journal.record(action, playfabId, player.DisplayName, charges, expiresAt)
+	if err != nil {
+		log.Warn("Action was sent but the journal could not be saved", "err", err)
+		err = nil
+	}
+	if action == "ban" || action == "trust" {
+		// The admin took care of the player
+		app.alerts.acknowledgePlayer(playfabId)
+	}
+	if action == "ban" {
+		app.notifyBan(player, playfabId, charges)
+	}
+	return
+}
+
+// notifyBan tells the notifiers about a ban that was sent from this client
+func (app *App) notifyBan(player validatedPlayer, playfabId string, charges []string) {
+	n := notification{
+		Event:       eventBan,
+		Title:       "Player banned",
+		Message:     app.describePlayer(playfabId) + " was banned",
+		PlayfabId:   playfabId,
+		DisplayName: player.DisplayName,
+		Charges:     charges,
+		Admin:       app.trust.admin,
+	}
+	if n.Admin != "" {
+		n.Message += " by " + n.Admin
+	}
+	n.Message += " for " + strings.Join(charges, ", ")
+	if _, ok := app.session.numbers.byPlayfabId(playfabId); ok {
+		n.ServerName = app.session.name
+	}
+	if _, longest, _ := app.charges.check(charges); longest.Name != "" {
+		n.Message += " (" + formatBanDuration(longest.Hours) + ")"
+	}
+	app.notifications.notify(n)
+}
+
+// checkCharges validates the charges of a ban against the predefined charges.
+// Unknown charges are only sent once the admin confirms them, check tells why.
+func (app *App) checkCharges(charges []string) (normalized []string, check string) {
+	normalized, _, err := app.charges.check(charges)
+	if err != nil {
+		check = err.Error()
+	}
+	return
+}
+
+// describePlayer names a player by display name and PlayFab ID, if the player was seen in this session
+func (app *App) describePlayer(playfabId string) string {
+	player, ok := app.findPlayer(playfabId)
+	if !ok {
+		return playfabId
+	}
+	return fmt.Sprintf("%s (%s)", player.DisplayName, playfabId)
+}
+
+// lookupPlayers searches the player records in the backend.
+// Backends without a lookup function can still find a player by PlayFab ID through the validation function.
+func (app *App) lookupPlayers(ctx context.Context, query string) (found []validatedPlayer, err error) {
+	found, err = app.svc.lookupPlayers(ctx, query)
+	if !errors.Is(err, ErrNotFound) || !isPlayfabId(query) {
+		return
+	}
+	log.Debug("Backend has no lookup function, validating the PlayFab ID instead", "id", query)
+	return app.svc.validatePlayers(ctx, "", []connectedPlayer{{PlayfabId: strings.ToUpper(query)}}, true)
+}
+
+// isPlayfabId reports whether the text looks like a PlayFab ID, which is 16 hex digits
+func isPlayfabId(text string) bool {
+	if len(text) != 16 {
+		return false
+	}
+	for _, c := range text {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchStdin(t *testing.T) {
+	events := watchStdin(context.Background(), strings.NewReader("kick 1\n\n  ban 2 spam  \nconfirm"))
+	var commands []string
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case command, ok := <-events:
+			if !ok {
+				want := []string{"kick 1", "ban 2 spam", "confirm"}
+				if !slices.Equal(commands, want) {
+					t.Errorf("commands = %q, want %q", commands, want)
+				}
+				return
+			}
+			commands = append(commands, command)
+		case <-timeout:
+			t.Fatal("the channel was not closed at the end of the input")
+		}
+	}
+}
+
+func TestWatchStdinCancel(t *testing.T) {
+	// The input never ends, so only the context can stop watching it
+	input, output := io.Pipe()
+	t.Cleanup(func() { _ = output.Close() })
+	go func() {
+		for {
+			_, err := output.Write([]byte("kick 1\n"))
+			if err != nil {
+				return
+			}
+		}
+	}()
+	ctx, cancel := context.WithCancel(context.Background())
+	events := watchStdin(ctx, input)
+	<-events
+	cancel()
+	select {
+	case <-waitClosed(events):
+	case <-time.After(5 * time.Second):
+		t.Fatal("the channel was not closed after the context was cancelled")
+	}
+
+	reader, writer := io.Pipe()
+	_ = writer.CloseWithError(io.ErrUnexpectedEOF)
+	select {
+	case <-waitClosed(watchStdin(context.Background(), reader)):
+	case <-time.After(5 * time.Second):
+		t.Fatal("the channel was not closed after a read error")
+	}
+}
+
+// waitClosed drains the channel and is closed once the channel is closed
+func waitClosed(events <-chan string) <-chan struct{} {
+	closed := make(chan struct{})
+	go func() {
+		for range events {
+		}
+		close(closed)
+	}()
+	return closed
+}
+
+func TestCompleteCommand(t *testing.T) {
+	app := newApp(nil, nil, nil, nil, io.Discard, appOptions{charges: &chargeCatalogue{charges: testCharges}})
+	app.completion.Store(&completionState{
+		players: []validatedPlayer{{Number: 1, DisplayName: "Alice"}, {Number: 12, DisplayName: "Bob"}},
+		servers: []string{"DEFSAK EU 1", "DEFSAK US"},
+	})
+	tests := []struct {
+		line       string
+		start      int
+		candidates []string
+	}{
+		{"ki", 0, []string{"kick"}},
+		{"un", 0, []string{"unbanbyid", "untrust", "undo"}},
+		{"kick ", 5, []string{"1", "12"}},
+		{"kick 1", 5, []string{"1", "12"}},
+		{"kick bo", 5, []string{"12"}},
+		{"ban 1 ch", 6, []string{"cheating"}},
+		{"ban 1 spam G", 11, []string{"griefing"}},
+		{"use 2", 4, []string{"2"}},
+		{"use def", 4, []string{"1", "2"}},
+		{"format j", 7, []string{"json", "jsonl"}},
+		{"kick 1 ", 7, nil},
+		{"unknown ", 8, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.line, func(t *testing.T) {
+			start, candidates := app.completeCommand(test.line)
+			var values []string
+			for _, candidate := range candidates {
+				values = append(values, candidate.value)
+			}
+			if start != test.start || !slices.Equal(values, test.candidates) {
+				t.Errorf("completions = %q at %d, want %q at %d", values, start, test.candidates, test.start)
+			}
+		})
+	}
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	confNamespace  = "chiv-admin-helper"
+	configFileName = "config.json"
+	envPrefix      = "CHIV_ADMIN_HELPER_"
+)
+
+type authMode string
+
+const (
+	// authIdToken uses the google service account from the credentials file
+	authIdToken authMode = "idtoken"
+	// authToken sends a static bearer token
+	authToken authMode = "token"
+	// authNone sends no authentication at all, which is only useful for a local mock backend
+	authNone authMode = "none"
+)
+
+// confirmPolicy decides which global actions have to be confirmed before they are sent
+type confirmPolicy string
+
+const (
+	// confirmBans asks before banning a player
+	confirmBans confirmPolicy = "bans"
+	// confirmAlways asks before every global action
+	confirmAlways confirmPolicy = "always"
+	// confirmNever sends every action right away
+	confirmNever confirmPolicy = "never"
+)
+
+// requires reports whether the policy wants the action confirmed
+func (policy confirmPolicy) requires(action string) bool {
+	switch policy {
+	case confirmAlways:
+		return true
+	case confirmNever:
+		return false
+	}
+	return action == "ban"
+}
+
+type config struct {
+	BackendUrl     string   `json:"backend_url"`
+	FunctionPrefix string   `json:"function_prefix"`
+	AuthMode       authMode `json:"auth_mode"`
+	Token          string   `json:"token"`
+	RequestTimeout duration `json:"request_timeout"`
+	MaxRetries     int      `json:"max_retries"`
+	CacheMaxAge    duration `json:"cache_max_age"`
+	WantedSync     duration `json:"wanted_sync_interval"`
+	// AdminName is recorded with local actions like trusting a player
+	AdminName string `json:"admin_name"`
+	// OutputFormat is one of outputFormats
+	OutputFormat   string        `json:"output_format"`
+	ConfirmActions confirmPolicy `json:"confirm_actions"`
+	// DryRun logs global actions instead of sending them to the backend
+	DryRun     bool     `json:"dry_run"`
+	UndoWindow duration `json:"undo_window"`
+	// AlertInterval is the minimum time between two notifications of a notifier
+	AlertInterval duration `json:"alert_interval"`
+	// Notify lists the notifiers of every event, see notificationEvents and notifierNames
+	Notify         map[string][]string `json:"notify"`
+	DiscordWebhook string              `json:"discord_webhook"`
+	// WebhookUrl receives every notification that is sent to the generic webhook notifier as JSON
+	WebhookUrl string `json:"webhook_url"`
+}
+
+var defaultConfig = config{
+	BackendUrl:     "https://europe-west3-prj-prd-chiv-01.cloudfunctions.net",
+	FunctionPrefix: "func-prd-",
+	AuthMode:       authIdToken,
+	RequestTimeout: duration(15 * time.Second),
+	MaxRetries:     3,
+	CacheMaxAge:    duration(7 * 24 * time.Hour),
+	OutputFormat:   "table",
+	ConfirmActions: confirmBans,
+	UndoWindow:     duration(10 * time.Minute),
+	AlertInterval:  duration(10 * time.Second),
+	Notify:         map[string][]string{eventWanted: {"bell"}},
+}
+
+// duration is a time.Duration that is written like "15s" in the config file
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var text string
+	err := json.Unmarshal(data, &text)
+	if err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(text)
+	if err != nil {
+		return err
+	}
+	*d = duration(parsed)
+	return nil
+}
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// configDir returns the directory that holds credentials and settings of this tool
+func configDir() (confDir string, err error) {
+	confDir, err = os.UserConfigDir()
+	if err != nil {
+		err = fmt.Errorf("could not determine user config dir: %w", err)
+		return
+	}
+	confDir = filepath.Join(confDir, confNamespace)
+	return
+}
+
+// loadConfig builds the configuration from the defaults, the config file, environment variables and command line flags.
+// Later sources override earlier ones. The arguments after the flags select the subcommand and are returned in commandArgs.
+func loadConfig(args []string) (cfg config, commandArgs []string, err error) {
+	cfg = defaultConfig
+	// The config file and flags add to the default notifications, they must not change the defaults themselves
+	cfg.Notify = maps.Clone(defaultConfig.Notify)
+
+	flags := flag.NewFlagSet(confNamespace, flag.ContinueOnError)
+	flags.Usage = func() {
+		printUsage(flags)
+	}
+	configPath := flags.String("config", "", "path to the config file (default: "+configFileName+" in the user config dir)")
+	backendUrl := flags.String("backend-url", "", "base URL of the backend cloud functions")
+	functionPrefix := flags.String("function-prefix", "", "prefix of the backend function names, for example func-stg-")
+	auth := flags.String("auth", "", "authentication mode: idtoken, token or none")
+	token := flags.String("token", "", "bearer token used by the token authentication mode")
+	requestTimeout := flags.Duration("request-timeout", 0, "deadline of a single backend call")
+	maxRetries := flags.Int("max-retries", 0, "how often failed backend calls are retried")
+	cacheMaxAge := flags.Duration("cache-max-age", 0, "how long validation results are cached, 0 disables the cache")
+	wantedSync := flags.Duration("wanted-sync-interval", 0, "how often the local wanted board mirror is synced, 0 disables the mirror")
+	adminName := flags.String("admin-name", "", "name recorded with local actions (default: the credentials account or the system user)")
+	outputFormat := flags.String("format", "", "how validated players are printed: "+strings.Join(outputFormats, ", "))
+	confirmActions := flags.String("confirm", "", "which global actions have to be confirmed: bans, always or never")
+	dryRun := flags.Bool("dry-run", false, "log global actions instead of sending them to the backend")
+	undoWindow := flags.Duration("undo-window", 0, "how long global actions can be undone, 0 disables undo")
+	alertInterval := flags.Duration("alert-interval", 0, "minimum time between two notifications of a notifier")
+	notify := flags.String("notify", "", "notifiers of events, for example wanted_player=bell,discord;ban=discord")
+	discordWebhook := flags.String("discord-webhook", "", "URL of the Discord webhook that the discord notifier posts to")
+	webhookUrl := flags.String("webhook-url", "", "URL that the webhook notifier posts notifications to as JSON")
+	err = flags.Parse(args)
+	if err != nil {
+		return
+	}
+	commandArgs = flags.Args()
+
+	// Environment variables fill in every flag that was not given on the command line
+	passedFlags := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		passedFlags[f.Name] = true
+	})
+	flags.VisitAll(func(f *flag.Flag) {
+		envName := envPrefix + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		envValue, ok := os.LookupEnv(envName)
+		if !ok || passedFlags[f.Name] || err != nil {
+			return
+		}
+		err = flags.Set(f.Name, envValue)
+		if err != nil {
+			err = fmt.Errorf("invalid value for %s: %w", envName, err)
+		}
+	})
+	if err != nil {
+		return
+	}
+
+	// Config file
+	path := *configPath
+	explicitPath := path != ""
+	if !explicitPath {
+		var confDir string
+		confDir, err = configDir()
+		if err != nil {
+			return
+		}
+		path = filepath.Join(confDir, configFileName)
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !explicitPath {
+		// The config file is optional
+		err = nil
+	} else if err != nil {
+		err = fmt.Errorf("could not read config file: %w", err)
+		return
+	} else {
+		err = json.Unmarshal(data, &cfg)
+		if err != nil {
+			err = fmt.Errorf("could not parse config file %s: %w", path, err)
+			return
+		}
+	}
+
+	// Flags and environment variables override the config file
+	flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "backend-url":
+			cfg.BackendUrl = *backendUrl
+		case "function-prefix":
+			cfg.FunctionPrefix = *functionPrefix
+		case "auth":
+			cfg.AuthMode = authMode(*auth)
+		case "token":
+			cfg.Token = *token
+		case "request-timeout":
+			cfg.RequestTimeout = duration(*requestTimeout)
+		case "max-retries":
+			cfg.MaxRetries = *maxRetries
+		case "cache-max-age":
+			cfg.CacheMaxAge = duration(*cacheMaxAge)
+		case "wanted-sync-interval":
+			cfg.WantedSync = duration(*wantedSync)
+		case "admin-name":
+			cfg.AdminName = *adminName
+		case "format":
+			cfg.OutputFormat = *outputFormat
+		case "confirm":
+			cfg.ConfirmActions = confirmPolicy(*confirmActions)
+		case "dry-run":
+			cfg.DryRun = *dryRun
+		case "undo-window":
+			cfg.UndoWindow = duration(*undoWindow)
+		case "alert-interval":
+			cfg.AlertInterval = duration(*alertInterval)
+		case "notify":
+			var routes map[string][]string
+			routes, err = parseNotifyRoutes(*notify)
+			if cfg.Notify == nil {
+				cfg.Notify = make(map[string][]string)
+			}
+			maps.Copy(cfg.Notify, routes)
+		case "discord-webhook":
+			cfg.DiscordWebhook = *discordWebhook
+		case "webhook-url":
+			cfg.WebhookUrl = *webhookUrl
+		}
+	})
+	if err != nil {
+		err = fmt.Errorf("invalid notifications: %w", err)
+		return
+	}
+
+	switch cfg.AuthMode {
+	case authIdToken, authNone:
+	case authToken:
+		if cfg.Token == "" {
+			err = errors.New("auth mode token requires a token")
+			return
+		}
+	default:
+		err = fmt.Errorf("unknown auth mode %q", cfg.AuthMode)
+		return
+	}
+	if cfg.RequestTimeout <= 0 {
+		err = errors.New("request timeout must be positive")
+		return
+	}
+	if cfg.MaxRetries < 0 {
+		err = errors.New("max retries can't be negative")
+		return
+	}
+	if !slices.Contains(outputFormats, cfg.OutputFormat) {
+		err = fmt.Errorf("unknown output format %q", cfg.OutputFormat)
+		return
+	}
+	switch cfg.ConfirmActions {
+	case confirmBans, confirmAlways, confirmNever:
+	default:
+		err = fmt.Errorf("unknown confirm policy %q", cfg.ConfirmActions)
+		return
+	}
+	err = checkNotifyRoutes(cfg)
+	return
+}
+
+// endpoint returns the URL of the backend function with the given name
+func (cfg config) endpoint(name string) string {
+	return strings.TrimRight(cfg.BackendUrl, "/") + "/" + cfg.FunctionPrefix + name
+}
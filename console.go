@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/charmbracelet/log"
+	"golang.org/x/term"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+const historyFileName = "history.json"
+
+// historySize is the number of commands that are remembered across sessions
+const historySize = 500
+
+// commandHistory keeps the latest console commands and saves them, so they can be recalled in the next session
+type commandHistory struct {
+	// entries are ordered oldest first
+	entries []string
+}
+
+// loadCommandHistory reads the commands of previous sessions from the config dir
+func loadCommandHistory() (history *commandHistory, err error) {
+	history = &commandHistory{}
+	err = loadJson(historyFileName, &history.entries)
+	if err != nil {
+		history.entries = nil
+	}
+	return
+}
+
+// Add remembers a command, repeating the previous command doesn't add it again
+func (history *commandHistory) Add(entry string) {
+	entry = strings.TrimSpace(entry)
+	if entry == "" || (len(history.entries) > 0 && history.entries[len(history.entries)-1] == entry) {
+		return
+	}
+	history.entries = append(history.entries, entry)
+	if len(history.entries) > historySize {
+		history.entries = history.entries[len(history.entries)-historySize:]
+	}
+	err := saveJson(historyFileName, history.entries)
+	if err != nil {
+		log.Warn("Failed to save command history", "err", err)
+	}
+}
+
+func (history *commandHistory) Len() int {
+	return len(history.entries)
+}
+
+// At returns the entry idx commands ago, 0 is the latest
+func (history *commandHistory) At(idx int) string {
+	return history.entries[len(history.entries)-1-idx]
+}
+
+// completion is a candidate for the word being completed on the console
+type completion struct {
+	value string
+	// label describes the candidate when several candidates are listed
+	label string
+}
+
+// console reads commands from a terminal with line editing, history and tab completion.
+// When stdin is not a terminal, for example when commands are piped in, plain lines are read instead.
+// Output has to be written through the console, so it doesn't mix with the line being edited.
+type console struct {
+	lock     sync.Mutex
+	terminal *term.Terminal
+	restore  func()
+	prompt   string
+	// complete returns the candidates for the word at the end of a command line, which starts at start
+	complete func(line string) (start int, candidates []completion)
+}
+
+// newConsole creates a console for stdin and stdout. Raw mode is only entered once the console is watched,
+// so stdin can still be used normally until then.
+func newConsole() *console {
+	return &console{prompt: "> "}
+}
+
+// setServer shows the server that commands refer to in the prompt
+func (c *console) setServer(serverName string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.prompt = "> "
+	if serverName != "" {
+		c.prompt = serverName + " > "
+	}
+	if c.terminal != nil {
+		c.terminal.SetPrompt(c.prompt)
+	}
+}
+
+func (c *console) Watch(ctx context.Context) <-chan string {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return watchStdin(ctx, os.Stdin)
+	}
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		log.Warn("Failed to set up line editing, reading plain lines instead", "err", err)
+		return watchStdin(ctx, os.Stdin)
+	}
+
+	c.lock.Lock()
+	prompt := c.prompt
+	c.lock.Unlock()
+	terminal := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout}, prompt)
+	history, err := loadCommandHistory()
+	if err != nil {
+		log.Warn("Failed to load command history, starting with an empty history", "err", err)
+	}
+	terminal.History = history
+	terminal.AutoCompleteCallback = c.autoComplete
+	c.lock.Lock()
+	c.terminal = terminal
+	c.restore = func() { _ = term.Restore(fd, state) }
+	c.lock.Unlock()
+
+	events := make(chan string)
+	go func() {
+		defer close(events)
+		for {
+			width, height, err := term.GetSize(fd)
+			if err == nil {
+				_ = terminal.SetSize(width, height)
+			}
+			command, err := terminal.ReadLine()
+			if errors.Is(err, io.EOF) {
+				// Ctrl+C or Ctrl+D, since raw mode doesn't send an interrupt
+				return
+			}
+			command = strings.TrimSpace(command)
+			if command == "" {
+				continue
+			}
+			select {
+			case events <- command:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events
+}
+
+// writer returns a writer that prints above the line that is being edited,
+// or to fallback while there is no line editor
+func (c *console) writer(fallback io.Writer) io.Writer {
+	return consoleWriter{c, fallback}
+}
+
+type consoleWriter struct {
+	console  *console
+	fallback io.Writer
+}
+
+func (w consoleWriter) Write(p []byte) (n int, err error) {
+	w.console.lock.Lock()
+	terminal := w.console.terminal
+	w.console.lock.Unlock()
+	if terminal == nil {
+		return w.fallback.Write(p)
+	}
+	return terminal.Write(p)
+}
+
+// close leaves raw mode
+func (c *console) close() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.restore != nil {
+		c.restore()
+		c.restore, c.terminal = nil, nil
+	}
+}
+
+// autoComplete completes the word before the cursor when Tab is pressed.
+// A single candidate is inserted, otherwise the common prefix is inserted or all candidates are listed.
+func (c *console) autoComplete(line string, pos int, key rune) (newLine string, newPos int, ok bool) {
+	if key != '\t' || c.complete == nil {
+		return
+	}
+	start, candidates := c.complete(line[:pos])
+	word := line[start:pos]
+	switch len(candidates) {
+	case 0:
+		return line, pos, true
+	case 1:
+		newLine = line[:start] + candidates[0].value + " " + strings.TrimLeft(line[pos:], " ")
+		return newLine, len(newLine) - len(strings.TrimLeft(line[pos:], " ")), true
+	}
+	prefix := candidates[0].value
+	for _, candidate := range candidates[1:] {
+		for !strings.HasPrefix(candidate.value, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	if len(prefix) > len(word) && strings.HasPrefix(prefix, word) {
+		return line[:start] + prefix + line[pos:], start + len(prefix), true
+	}
+	labels := make([]string, 0, len(candidates))
+	for _, candidate := range candidates {
+		labels = append(labels, candidate.label)
+	}
+	_, _ = c.writer(os.Stdout).Write([]byte(strings.Join(labels, "   ") + "\n"))
+	return line, pos, true
+}
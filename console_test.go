@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCommandHistory(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	history, err := loadCommandHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, command := range []string{"kick 1", "  ", "ban 2 spam ", "ban 2 spam", "kick 1"} {
+		history.Add(command)
+	}
+	// Empty commands and repetitions are not remembered
+	want := []string{"kick 1", "ban 2 spam", "kick 1"}
+	if history.Len() != len(want) {
+		t.Fatalf("history has %d entries, want %d", history.Len(), len(want))
+	}
+	for i := range want {
+		if entry := history.At(i); entry != want[len(want)-1-i] {
+			t.Errorf("entry %d = %q, want %q", i, entry, want[len(want)-1-i])
+		}
+	}
+
+	// The next session starts with the history of this one, up to historySize entries
+	for i := range historySize {
+		history.Add(fmt.Sprintf("kick %d", i))
+	}
+	loaded, err := loadCommandHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Len() != historySize || loaded.At(0) != fmt.Sprintf("kick %d", historySize-1) {
+		t.Errorf("loaded %d entries ending with %q, want %d ending with the latest", loaded.Len(), loaded.At(0), historySize)
+	}
+}
+
+func TestAutoComplete(t *testing.T) {
+	c := newConsole()
+	c.complete = func(line string) (start int, candidates []completion) {
+		switch line {
+		case "ki":
+			return 0, []completion{{"kick", "kick <player-number>"}}
+		case "ban 1 h":
+			return 6, []completion{{"harassment", "harassment"}, {"hate_speech", "hate_speech"}}
+		}
+		return len(line), nil
+	}
+	tests := []struct {
+		name    string
+		line    string
+		pos     int
+		key     rune
+		newLine string
+		newPos  int
+		ok      bool
+	}{
+		{"single candidate", "ki", 2, '\t', "kick ", 5, true},
+		{"single candidate before text", "ki 1", 2, '\t', "kick 1", 5, true},
+		{"common prefix", "ban 1 h", 7, '\t', "ban 1 ha", 8, true},
+		{"no candidate", "xyz", 3, '\t', "xyz", 3, true},
+		{"other key", "ki", 2, 'x', "", 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			newLine, newPos, ok := c.autoComplete(test.line, test.pos, test.key)
+			if newLine != test.newLine || newPos != test.newPos || ok != test.ok {
+				t.Errorf("autoComplete = %q, %d, %v, want %q, %d, %v", newLine, newPos, ok, test.newLine, test.newPos, test.ok)
+			}
+		})
+	}
+}
@@ -2,69 +2,83 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
 )
 
-const (
-	confNamespace = "chiv-admin-helper"
-)
-
+// setupCredentials returns the credentials file in the config dir. On the first start there is none yet,
+// so the user is asked for their credentials file, which is copied to the config dir.
+// The config dir itself might already exist, since other files are saved there even without credentials.
 func setupCredentials() (credentialPath string, err error) {
-	confDir, err := os.UserConfigDir()
+	confDir, err := configDir()
 	if err != nil {
-		err = fmt.Errorf("could not determine user config dir: %w", err)
+		return
 	}
-	confDir = filepath.Join(confDir, confNamespace)
-	err = os.Mkdir(confDir, 0700)
-	if errors.Is(err, os.ErrExist) {
-		// Config dir exists and might contain credentials
-		var files []fs.DirEntry
-		files, err = os.ReadDir(confDir)
-		if err != nil {
-			err = fmt.Errorf("could not read config dir: %w", err)
-			return
-		}
-		for _, file := range files {
-			if filepath.Ext(file.Name()) != ".json" {
-				continue
-			}
-			credentialPath = filepath.Join(confDir, file.Name())
-			return credentialPath, nil
-		}
-		err = errors.New("could not find json credential file")
+	err = os.MkdirAll(confDir, 0700)
+	if err != nil {
+		err = fmt.Errorf("failed to setup user config dir: %w", err)
 		return
-	} else if err == nil {
-		// Config dir did not exist yet but was created
-		// Ask user for their credential file
-		fmt.Print("Credentials are required to use this tool. Enter the path to your credentials file and press enter: ")
-		inputPath, _ := bufio.NewReader(os.Stdin).ReadString('\n')
-		inputPath = strings.Trim(inputPath, "\r\n\" ")
-		inputPath = filepath.Clean(inputPath)
-		// Copy credentials to a safe location
-		var originalCredentials, savedCredentials *os.File
-		originalCredentials, err = os.Open(inputPath)
-		if err != nil {
-			err = fmt.Errorf("could not open credentials file: %w", err)
-			return
-		}
-		defer originalCredentials.Close()
-		credentialPath = filepath.Join(confDir, filepath.Base(inputPath))
-		savedCredentials, err = os.OpenFile(credentialPath, os.O_CREATE, 0600)
-		if err != nil {
-			err = fmt.Errorf("could not save credentials to config: %w", err)
+	}
+	files, err := os.ReadDir(confDir)
+	if err != nil {
+		err = fmt.Errorf("could not read config dir: %w", err)
+		return
+	}
+	for _, file := range files {
+		// Files of the tool are kept in the state dir, so the only other json file is the config file
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" || file.Name() == configFileName {
+			continue
 		}
-		defer savedCredentials.Close()
-		_, _ = io.Copy(savedCredentials, originalCredentials)
-		// Return the new credential file
+		credentialPath = filepath.Join(confDir, file.Name())
+		return credentialPath, nil
+	}
+
+	// Ask user for their credential file
+	fmt.Print("Credentials are required to use this tool. Enter the path to your credentials file and press enter: ")
+	inputPath, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	inputPath = strings.Trim(inputPath, "\r\n\" ")
+	inputPath = filepath.Clean(inputPath)
+	if filepath.Ext(inputPath) != ".json" {
+		err = errors.New("the credentials file has to be a .json file")
+		return
+	}
+	// Copy credentials to a safe location
+	originalCredentials, err := os.Open(inputPath)
+	if err != nil {
+		err = fmt.Errorf("could not open credentials file: %w", err)
+		return
+	}
+	defer originalCredentials.Close()
+	credentialPath = filepath.Join(confDir, filepath.Base(inputPath))
+	savedCredentials, err := os.OpenFile(credentialPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		err = fmt.Errorf("could not save credentials to config: %w", err)
+		return
+	}
+	_, err = io.Copy(savedCredentials, originalCredentials)
+	closeErr := savedCredentials.Close()
+	if err != nil || closeErr != nil {
+		err = fmt.Errorf("could not save credentials to config: %w", errors.Join(err, closeErr))
+		_ = os.Remove(credentialPath)
 		return
 	}
-	// Mkdir failed
-	err = fmt.Errorf("failed to setup user config dir: %w", err)
 	return
 }
+
+// credentialsIdentity returns the account email of the credentials file, or an empty string if it has none
+func credentialsIdentity(credentialPath string) string {
+	data, err := os.ReadFile(credentialPath)
+	if err != nil {
+		return ""
+	}
+	credentials := struct {
+		ClientEmail string `json:"client_email"`
+	}{}
+	_ = json.Unmarshal(data, &credentials)
+	return credentials.ClientEmail
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"time"
+)
+
+// playerScan is a player list that was shown for a server
+type playerScan struct {
+	players   []validatedPlayer
+	scannedAt time.Time
+}
+
+// renamedPlayer is a player that changed their display name between two scans
+type renamedPlayer struct {
+	player       validatedPlayer
+	previousName string
+}
+
+// scanDiff describes how the players of a server changed since the previous scan
+type scanDiff struct {
+	// since is the time of the previous scan
+	since   time.Time
+	joined  []validatedPlayer
+	left    []validatedPlayer
+	renamed []renamedPlayer
+}
+
+// diffScans compares the players of a scan with the previous scan of the same server
+func diffScans(previous playerScan, current []validatedPlayer) (diff scanDiff) {
+	diff.since = previous.scannedAt
+	previousPlayers := make(map[string]validatedPlayer, len(previous.players))
+	for _, player := range previous.players {
+		previousPlayers[player.PlayfabId] = player
+	}
+	currentIds := make(map[string]bool, len(current))
+	for _, player := range current {
+		currentIds[player.PlayfabId] = true
+		previousPlayer, ok := previousPlayers[player.PlayfabId]
+		if !ok {
+			diff.joined = append(diff.joined, player)
+		} else if previousPlayer.DisplayName != player.DisplayName {
+			diff.renamed = append(diff.renamed, renamedPlayer{player, previousPlayer.DisplayName})
+		}
+	}
+	for _, player := range previous.players {
+		if !currentIds[player.PlayfabId] {
+			diff.left = append(diff.left, player)
+		}
+	}
+	return
+}
+
+// empty reports whether nobody joined, left or changed their name
+func (diff scanDiff) empty() bool {
+	return len(diff.joined) == 0 && len(diff.left) == 0 && len(diff.renamed) == 0
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDiffScans(t *testing.T) {
+	bob := validatedPlayer{PlayfabId: "AAAA000000000001", DisplayName: "Bob"}
+	alice := validatedPlayer{PlayfabId: "AAAA000000000002", DisplayName: "Alice"}
+	carl := validatedPlayer{PlayfabId: "AAAA000000000003", DisplayName: "Carl"}
+	renamedBob := validatedPlayer{PlayfabId: "AAAA000000000001", DisplayName: "Robert"}
+	tests := []struct {
+		name     string
+		previous []validatedPlayer
+		current  []validatedPlayer
+		joined   []string
+		left     []string
+		// renamed are the previous names of the renamed players
+		renamed []string
+	}{
+		{"unchanged", []validatedPlayer{bob, alice}, []validatedPlayer{alice, bob}, nil, nil, nil},
+		{"joined and left", []validatedPlayer{bob, alice}, []validatedPlayer{alice, carl}, []string{"Carl"}, []string{"Bob"}, nil},
+		{"renamed", []validatedPlayer{bob}, []validatedPlayer{renamedBob}, nil, nil, []string{"Bob"}},
+		{"first scan", nil, []validatedPlayer{bob}, []string{"Bob"}, nil, nil},
+		{"empty server", []validatedPlayer{bob}, nil, nil, []string{"Bob"}, nil},
+	}
+	names := func(players []validatedPlayer) (names []string) {
+		for _, player := range players {
+			names = append(names, player.DisplayName)
+		}
+		return
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scannedAt := time.Now().Add(-time.Minute)
+			diff := diffScans(playerScan{players: test.previous, scannedAt: scannedAt}, test.current)
+			var renamed []string
+			for _, player := range diff.renamed {
+				renamed = append(renamed, player.previousName)
+			}
+			if !slices.Equal(names(diff.joined), test.joined) || !slices.Equal(names(diff.left), test.left) || !slices.Equal(renamed, test.renamed) {
+				t.Errorf("joined %q, left %q, renamed %q, want %q, %q and %q",
+					names(diff.joined), names(diff.left), renamed, test.joined, test.left, test.renamed)
+			}
+			if !diff.since.Equal(scannedAt) {
+				t.Errorf("since = %v, want the time of the previous scan", diff.since)
+			}
+			if empty := test.joined == nil && test.left == nil && test.renamed == nil; diff.empty() != empty {
+				t.Errorf("empty = %v, want %v", diff.empty(), empty)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// fakeClipboard is an in-memory ClipboardBackend that allows driving the app without a desktop session
+type fakeClipboard struct {
+	lock    sync.Mutex
+	data    string
+	changes uint64
+	writes  []string
+}
+
+// Paste replaces the clipboard contents as if the admin copied text in game
+func (c *fakeClipboard) Paste(data string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.data = data
+	c.changes++
+}
+
+// Writes returns every string the app wrote to the clipboard, oldest first
+func (c *fakeClipboard) Writes() []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([]string(nil), c.writes...)
+}
+
+func (c *fakeClipboard) ChangeCount() uint64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.changes
+}
+
+func (c *fakeClipboard) ReadString() (data string, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.data, nil
+}
+
+func (c *fakeClipboard) WriteString(data string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.data = data
+	c.changes++
+	c.writes = append(c.writes, data)
+	return nil
+}
+
+// fakeEvents is an EventSource that emits whatever is sent to it, for example clipboard dumps or console commands
+type fakeEvents struct {
+	events chan string
+}
+
+func newFakeEvents() *fakeEvents {
+	return &fakeEvents{events: make(chan string)}
+}
+
+// Send emits an event and blocks until the app has picked it up
+func (e *fakeEvents) Send(event string) {
+	e.events <- event
+}
+
+// Close ends the event stream, which stops the app
+func (e *fakeEvents) Close() {
+	close(e.events)
+}
+
+func (e *fakeEvents) Watch(ctx context.Context) <-chan string {
+	return e.events
+}
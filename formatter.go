@@ -3,10 +3,11 @@ package main
 import (
 	"fmt"
 	"github.com/charmbracelet/lipgloss"
-	"github.com/gen2brain/beeep"
+	"io"
 	"slices"
 	"strconv"
 	"strings"
+	"time"
 	"unicode/utf8"
 )
 
@@ -22,11 +23,9 @@ var styles = map[string]lipgloss.Style{
 	"wanted":     lipgloss.NewStyle().Background(lipgloss.Color("#FF0000")),
 }
 
-// printTable nicely formats the list of validated players and adds coloring and audio clues
-func printTable(validatedPlayers []validatedPlayer) {
-	slices.SortFunc(validatedPlayers, func(a, b validatedPlayer) int {
-		return strings.Compare(a.DisplayName, b.DisplayName)
-	})
+// printTable nicely formats the list of validated players and adds coloring
+func printTable(out io.Writer, validatedPlayers []validatedPlayer) {
+	sortPlayers(validatedPlayers)
 
 	maxDisplayNameLength := 0
 	for _, player := range validatedPlayers {
@@ -36,28 +35,240 @@ func printTable(validatedPlayers []validatedPlayer) {
 		}
 	}
 
-	for i, player := range validatedPlayers {
+	// Widths of the additional listplayers columns, which are aligned across all rows
+	columnWidths := make(map[string]int)
+	for _, player := range validatedPlayers {
+		for _, column := range player.Connection.Columns {
+			width := utf8.RuneCountInString(column.Value)
+			if isStatsColumn(column.Name) && width > columnWidths[column.Name] {
+				columnWidths[column.Name] = width
+			}
+		}
+	}
+
+	for _, player := range validatedPlayers {
 		aliases := strings.Join(player.Aliases, ", ")
+		stats := make([]string, 0, len(player.Connection.Columns))
+		for _, column := range player.Connection.Columns {
+			if isStatsColumn(column.Name) {
+				stats = append(stats, fmt.Sprintf("%s %*s", column.Name, columnWidths[column.Name], column.Value))
+			}
+		}
+		createdAt := "????-??-?? ??:??"
+		if !player.CreatedAt.IsZero() {
+			createdAt = player.CreatedAt.Format("2006-01-02 15:04")
+		}
 		lines := make([]string, 1)
 		lines[0] = fmt.Sprintf(
-			"%2d)  %-16s  %s  %1s  %-"+strconv.Itoa(maxDisplayNameLength)+"s (%s)",
-			i,
+			"%2d)  %-16s  %s  %1s  %-"+strconv.Itoa(maxDisplayNameLength)+"s",
+			player.Number,
 			player.PlayfabId,
-			player.CreatedAt.Format("2006-01-02 15:04"),
+			createdAt,
 			platforms[player.Platform],
 			player.DisplayName,
-			aliases,
 		)
+		if len(stats) > 0 {
+			lines[0] += "  " + strings.Join(stats, "  ")
+		}
+		lines[0] += " (" + aliases + ")"
+		if !player.CachedAt.IsZero() {
+			lines[0] += " [cached " + formatAge(time.Since(player.CachedAt)) + " ago]"
+		}
 		if len(player.WantedFor) > 0 {
 			lines = append(lines, "Wanted for: "+strings.Join(player.WantedFor, ", "))
 		}
 		if player.BanCommand != "" {
 			lines = append(lines, player.BanCommand)
 		}
-		if player.WantedLevel == "wanted" {
-			go beeep.Beep(beeep.DefaultFreq, 100)
+		fmt.Fprintln(out, styles[player.WantedLevel].Render(strings.Join(lines, "\n")))
+	}
+	fmt.Fprintln(out)
+}
+
+// printDiff shows a compact summary of the players who joined, left or changed their name since the previous scan.
+// Wanted and suspicious players who joined are highlighted.
+func printDiff(out io.Writer, diff scanDiff) {
+	summary := fmt.Sprintf("Since last scan %s ago: ", formatAge(time.Since(diff.since)))
+	if diff.empty() {
+		fmt.Fprintln(out, summary+"no changes")
+		fmt.Fprintln(out)
+		return
+	}
+	fmt.Fprintf(out, "%s%d joined, %d left, %d renamed\n", summary, len(diff.joined), len(diff.left), len(diff.renamed))
+	for _, player := range diff.joined {
+		line := fmt.Sprintf("+ %2d) %s", player.Number, player.DisplayName)
+		if player.WantedLevel != "" {
+			line += "  " + strings.ToUpper(player.WantedLevel)
+		}
+		if len(player.WantedFor) > 0 {
+			line += " for " + strings.Join(player.WantedFor, ", ")
+		}
+		fmt.Fprintln(out, styles[player.WantedLevel].Render(line))
+	}
+	for _, player := range diff.left {
+		fmt.Fprintf(out, "- %2d) %s\n", player.Number, player.DisplayName)
+	}
+	for _, renamed := range diff.renamed {
+		fmt.Fprintf(out, "~ %2d) %s is now %s\n", renamed.player.Number, renamed.previousName, renamed.player.DisplayName)
+	}
+	fmt.Fprintln(out)
+}
+
+// printTrustList shows the players on the local trust list
+func printTrustList(out io.Writer, entries []trustEntry) {
+	if len(entries) == 0 {
+		fmt.Fprintln(out, "No players have been trusted from this client")
+		return
+	}
+	now := time.Now()
+	for _, entry := range entries {
+		expires := "never expires"
+		if entry.ExpiresAt != nil {
+			expires = "expires in " + formatAge(entry.ExpiresAt.Sub(now))
+		}
+		trustedBy := entry.TrustedBy
+		if trustedBy == "" {
+			trustedBy = "unknown"
+		}
+		status := "pending"
+		if entry.Confirmed {
+			status = "confirmed"
+		}
+		fmt.Fprintf(out, "%-16s  %s  %-9s  %-20s  by %s, %s\n",
+			entry.PlayfabId,
+			entry.TrustedAt.Format("2006-01-02 15:04"),
+			status,
+			entry.DisplayName,
+			trustedBy,
+			expires,
+		)
+	}
+	fmt.Fprintln(out)
+}
+
+// printHelp lists the console commands with their arguments
+func printHelp(out io.Writer, commands []consoleCommand) {
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "%-40s %s\n", strings.TrimSpace(cmd.name+" "+cmd.args), cmd.description)
+	}
+	fmt.Fprintln(out)
+}
+
+// printPlayerRecords shows everything that is known about the players of a lookup
+func printPlayerRecords(out io.Writer, players []validatedPlayer) {
+	for _, player := range players {
+		lines := []string{player.DisplayName + "  " + player.PlayfabId}
+		createdAt := "unknown"
+		if !player.CreatedAt.IsZero() {
+			createdAt = player.CreatedAt.Format("2006-01-02 15:04")
+		}
+		lines = append(lines, "  Created:     "+createdAt)
+		if player.Platform != "" {
+			lines = append(lines, "  Platform:    "+player.Platform)
+		}
+		if len(player.Aliases) > 0 {
+			lines = append(lines, "  Aliases:     "+strings.Join(player.Aliases, ", "))
+		}
+		status := "not wanted"
+		if player.WantedLevel != "" {
+			status = player.WantedLevel
+		}
+		lines = append(lines, "  Status:      "+status)
+		if len(player.WantedFor) > 0 {
+			lines = append(lines, "  Wanted for:  "+strings.Join(player.WantedFor, ", "))
+		}
+		if player.BanCommand != "" {
+			lines = append(lines, "  Ban command: "+player.BanCommand)
+		}
+		fmt.Fprintln(out, styles[player.WantedLevel].Render(strings.Join(lines, "\n")))
+	}
+	fmt.Fprintln(out)
+}
+
+// printAlerts lists the alerts that were not acknowledged yet
+func printAlerts(out io.Writer, alerts []alert) {
+	if len(alerts) == 0 {
+		fmt.Fprintln(out, "There are no pending alerts")
+		return
+	}
+	for _, pending := range alerts {
+		line := fmt.Sprintf("%2d)  %4s ago  %-10s  player %2d  %s on %s",
+			pending.Number, formatAge(time.Since(pending.RaisedAt)), pending.Player.WantedLevel,
+			pending.Player.Number, pending.Player.DisplayName, pending.ServerName)
+		if len(pending.Player.WantedFor) > 0 {
+			line += " for " + strings.Join(pending.Player.WantedFor, ", ")
+		}
+		fmt.Fprintln(out, styles[pending.Player.WantedLevel].Render(line))
+	}
+	fmt.Fprintln(out)
+}
+
+// printServers lists the servers of this session and marks the one commands refer to
+func printServers(out io.Writer, sessions []*serverSession, current *serverSession) {
+	if len(sessions) == 0 {
+		fmt.Fprintln(out, "No server has been scanned in this session")
+		return
+	}
+	for i, session := range sessions {
+		marker := " "
+		if session == current {
+			marker = "*"
+		}
+		scanned := "not validated yet"
+		if !session.lastScan.scannedAt.IsZero() {
+			scanned = "scanned " + formatAge(time.Since(session.lastScan.scannedAt)) + " ago"
 		}
-		fmt.Println(styles[player.WantedLevel].Render(strings.Join(lines, "\n")))
+		fmt.Fprintf(out, "%s %2d)  %-40s  %2d players  %s\n", marker, i+1, session.name, len(session.players), scanned)
 	}
-	fmt.Println()
+	fmt.Fprintln(out)
+}
+
+// printCharges shows the predefined ban charges with their ban duration and message
+func printCharges(out io.Writer, charges []banCharge) {
+	for _, charge := range charges {
+		fmt.Fprintf(out, "%-22s %-10s %s\n", charge.Name, formatBanDuration(charge.Hours), charge.Message)
+	}
+	fmt.Fprintln(out)
+}
+
+// printJournal shows the recent global actions and whether they can still be undone
+func printJournal(out io.Writer, entries []journalEntry, window time.Duration) {
+	if len(entries) == 0 {
+		fmt.Fprintln(out, "No global actions have been sent recently")
+		return
+	}
+	for _, entry := range entries {
+		player := entry.PlayfabId
+		if entry.DisplayName != "" {
+			player = entry.DisplayName + " (" + entry.PlayfabId + ")"
+		}
+		if len(entry.Charges) > 0 {
+			player += " for " + strings.Join(entry.Charges, ", ")
+		}
+		age := time.Since(entry.SentAt)
+		var status string
+		switch {
+		case entry.Undone:
+			status = "undone"
+		case entry.UndoOf != 0:
+			status = fmt.Sprintf("undo of %d", entry.UndoOf)
+		case window > 0 && age <= window:
+			status = "undo " + strconv.Itoa(entry.Number)
+		}
+		fmt.Fprintf(out, "%2d)  %4s ago  %-7s  %s  %s\n", entry.Number, formatAge(age), entry.Action, player, status)
+	}
+	fmt.Fprintln(out)
+}
+
+// sortPlayers puts the players in the order of the printed table, which the player numbers refer to
+func sortPlayers(validatedPlayers []validatedPlayer) {
+	slices.SortFunc(validatedPlayers, func(a, b validatedPlayer) int {
+		return strings.Compare(a.DisplayName, b.DisplayName)
+	})
+}
+
+// isStatsColumn reports whether a listplayers column is shown in the table.
+// ID columns are left out since the PlayFab ID is already shown and the others are too long.
+func isStatsColumn(name string) bool {
+	return !strings.HasSuffix(normalizeColumnName(name), "id")
 }
@@ -0,0 +1,347 @@
+// Package mockbackend is a local stand-in for the validate_players, player_action, lookup_players, wanted_board_sync
+// and ban_charges cloud functions, for tests and the mockbackend command. It also accepts notifications at /webhook and logs them.
+package mockbackend
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Player is a player record as the validation and lookup functions return it
+type Player struct {
+	PlayfabId   string    `json:"playfab_id"`
+	DisplayName string    `json:"display_name"`
+	Aliases     []string  `json:"aliases"`
+	CreatedAt   time.Time `json:"created_at"`
+	Platform    string    `json:"platform"`
+	BanCommand  string    `json:"ban_command"`
+	WantedFor   []string  `json:"wanted_for"`
+	WantedLevel string    `json:"wanted_level"`
+}
+
+type wantedEntry struct {
+	PlayfabId  string   `json:"playfab_id"`
+	WantedFor  []string `json:"wanted_for"`
+	BanCommand string   `json:"ban_command"`
+	Removed    bool     `json:"removed,omitempty"`
+}
+
+type banCharge struct {
+	Name    string `json:"name"`
+	Hours   int    `json:"duration_hours"`
+	Message string `json:"message"`
+}
+
+// BanCharges is the catalogue of predefined ban reasons, the same as the one shipped with the client.
+// Bans for other reasons are permanent.
+var BanCharges = []banCharge{
+	{"admin_impersonation", 720, "Impersonating an admin"},
+	{"ban_evasion", 0, "Evading a ban"},
+	{"cheating", 0, "Cheating"},
+	{"exploiting", 168, "Exploiting bugs"},
+	{"ffa", 24, "Free for all in a team mode"},
+	{"griefing", 24, "Team killing or griefing"},
+	{"harassment", 72, "Harassing players"},
+	{"hate_speech", 720, "Hate speech"},
+	{"player_impersonation", 168, "Impersonating a player"},
+	{"spam", 24, "Spamming chat or voice"},
+}
+
+// syncPageSize is kept small so clients have to handle paginated syncs
+const syncPageSize = 50
+
+type connectedPlayer struct {
+	DisplayName string `json:"display_name"`
+	PlayfabId   string `json:"playfab_id"`
+}
+
+// Backend implements the cloud functions with all player records in memory
+type Backend struct {
+	lock    sync.Mutex
+	token   string
+	players map[string]*Player
+	trusted map[string]bool
+	// changes is the history of the wanted board, the sync cursor is an index into it
+	changes []wantedEntry
+	// actions are the player actions that were applied
+	actions []string
+}
+
+// New creates a backend that knows the players. When token is set, every request has to send it as bearer token.
+func New(token string, players []Player) *Backend {
+	backend := &Backend{
+		token:   token,
+		players: make(map[string]*Player),
+		trusted: make(map[string]bool),
+	}
+	for i := range players {
+		player := players[i]
+		backend.players[player.PlayfabId] = &player
+		if player.WantedLevel == "wanted" {
+			backend.recordChange(&player)
+		}
+	}
+	return backend
+}
+
+// Actions returns the applied player actions, each as the action, the PlayFab ID and the charges of a ban
+func (b *Backend) Actions() []string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return slices.Clone(b.actions)
+}
+
+// ServeHTTP routes requests by the suffix of the function name, so any function prefix works
+func (b *Backend) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if r.URL.Path == "/webhook" {
+		// Webhooks are called without the backend token
+		logWebhook(w, r)
+		return
+	}
+	if b.token != "" && r.Header.Get("Authorization") != "Bearer "+b.token {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	switch {
+	case strings.HasSuffix(r.URL.Path, "validate_players"):
+		b.validatePlayers(w, r)
+	case strings.HasSuffix(r.URL.Path, "player_action"):
+		b.playerAction(w, r)
+	case strings.HasSuffix(r.URL.Path, "lookup_players"):
+		b.lookupPlayers(w, r)
+	case strings.HasSuffix(r.URL.Path, "wanted_board_sync"):
+		b.syncWantedBoard(w, r)
+	case strings.HasSuffix(r.URL.Path, "ban_charges"):
+		writeJson(w, map[string]any{"charges": BanCharges})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (b *Backend) validatePlayers(w http.ResponseWriter, r *http.Request) {
+	reqParams := struct {
+		CheckWantedBoard bool              `json:"check_wanted_board"`
+		ServerName       string            `json:"server_name"`
+		Players          []connectedPlayer `json:"players"`
+	}{}
+	err := json.NewDecoder(r.Body).Decode(&reqParams)
+	if err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	Players := make([]Player, 0, len(reqParams.Players))
+	for _, connected := range reqParams.Players {
+		player := b.record(connected.PlayfabId)
+		// Clients that only know the PlayFab ID send no name
+		if connected.DisplayName != "" && player.DisplayName != connected.DisplayName {
+			if player.DisplayName != "" && !slices.Contains(player.Aliases, player.DisplayName) {
+				player.Aliases = append(player.Aliases, player.DisplayName)
+			}
+			player.DisplayName = connected.DisplayName
+		}
+		result := *player
+		if !reqParams.CheckWantedBoard && result.WantedLevel == "wanted" {
+			result.WantedLevel = ""
+			result.WantedFor = nil
+			result.BanCommand = ""
+		}
+		if b.trusted[result.PlayfabId] && result.WantedLevel == "suspicious" {
+			result.WantedLevel = ""
+			result.BanCommand = ""
+		}
+		Players = append(Players, result)
+	}
+	writeJson(w, map[string]any{"validated_players": Players})
+}
+
+func (b *Backend) playerAction(w http.ResponseWriter, r *http.Request) {
+	reqParams := struct {
+		Action     string         `json:"action"`
+		PlayFabId  string         `json:"playfab_id"`
+		Parameters map[string]any `json:"parameters"`
+	}{}
+	err := json.NewDecoder(r.Body).Decode(&reqParams)
+	if err != nil || reqParams.PlayFabId == "" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	player := b.record(reqParams.PlayFabId)
+	outputCommand := ""
+	switch reqParams.Action {
+	case "ban":
+		charges := make([]string, 0)
+		rawCharges, _ := reqParams.Parameters["charges"].([]any)
+		for _, charge := range rawCharges {
+			if s, ok := charge.(string); ok {
+				charges = append(charges, s)
+			}
+		}
+		if len(charges) == 0 {
+			http.Error(w, "ban requires at least 1 charge", http.StatusBadRequest)
+			return
+		}
+		player.WantedFor = charges
+		player.WantedLevel = "wanted"
+		outputCommand = "banbyid " + player.PlayfabId + " " + strconv.Itoa(banHours(charges)) + " " + strings.Join(charges, ", ")
+		player.BanCommand = outputCommand
+		b.recordChange(player)
+	case "unban":
+		player.WantedFor = nil
+		player.WantedLevel = ""
+		player.BanCommand = ""
+		outputCommand = "unbanbyid " + player.PlayfabId
+		b.recordChange(player)
+	case "trust":
+		b.trusted[player.PlayfabId] = true
+	case "untrust":
+		delete(b.trusted, player.PlayfabId)
+	default:
+		http.Error(w, "unknown action "+reqParams.Action, http.StatusBadRequest)
+		return
+	}
+	action := reqParams.Action + " " + player.PlayfabId
+	if reqParams.Action == "ban" {
+		action += " " + strings.Join(player.WantedFor, " ")
+	}
+	b.actions = append(b.actions, action)
+	writeJson(w, map[string]any{"output_command": outputCommand})
+}
+
+// lookupLimit is the maximum number of players a lookup returns
+const lookupLimit = 20
+
+func (b *Backend) lookupPlayers(w http.ResponseWriter, r *http.Request) {
+	reqParams := struct {
+		Query string `json:"query"`
+	}{}
+	err := json.NewDecoder(r.Body).Decode(&reqParams)
+	if err != nil || strings.TrimSpace(reqParams.Query) == "" {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	query := strings.ToLower(strings.TrimSpace(reqParams.Query))
+	players := make([]Player, 0)
+	for _, player := range b.players {
+		matches := strings.ToLower(player.PlayfabId) == query || strings.Contains(strings.ToLower(player.DisplayName), query)
+		for _, alias := range player.Aliases {
+			matches = matches || strings.Contains(strings.ToLower(alias), query)
+		}
+		if !matches {
+			continue
+		}
+		result := *player
+		if b.trusted[result.PlayfabId] && result.WantedLevel == "suspicious" {
+			result.WantedLevel = ""
+			result.BanCommand = ""
+		}
+		players = append(players, result)
+	}
+	slices.SortFunc(players, func(a, b Player) int {
+		return strings.Compare(a.DisplayName, b.DisplayName)
+	})
+	if len(players) > lookupLimit {
+		players = players[:lookupLimit]
+	}
+	writeJson(w, map[string]any{"players": players})
+}
+
+func (b *Backend) syncWantedBoard(w http.ResponseWriter, r *http.Request) {
+	reqParams := struct {
+		Cursor string `json:"cursor"`
+	}{}
+	err := json.NewDecoder(r.Body).Decode(&reqParams)
+	if err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	start := 0
+	if reqParams.Cursor != "" {
+		start, err = strconv.Atoi(reqParams.Cursor)
+		if err != nil || start < 0 || start > len(b.changes) {
+			http.Error(w, "invalid cursor", http.StatusBadRequest)
+			return
+		}
+	}
+	end := min(start+syncPageSize, len(b.changes))
+	writeJson(w, map[string]any{
+		"changes": b.changes[start:end],
+		"cursor":  strconv.Itoa(end),
+		"more":    end < len(b.changes),
+	})
+}
+
+// banHours returns the longest ban duration of the charges, 0 is permanent
+func banHours(names []string) (hours int) {
+	for _, name := range names {
+		i := slices.IndexFunc(BanCharges, func(charge banCharge) bool { return charge.Name == name })
+		if i < 0 || BanCharges[i].Hours == 0 {
+			return 0
+		}
+		hours = max(hours, BanCharges[i].Hours)
+	}
+	return
+}
+
+// recordChange appends the current wanted status of the player to the wanted board history
+func (b *Backend) recordChange(player *Player) {
+	b.changes = append(b.changes, wantedEntry{
+		PlayfabId:  player.PlayfabId,
+		WantedFor:  player.WantedFor,
+		BanCommand: player.BanCommand,
+		Removed:    player.WantedLevel != "wanted",
+	})
+}
+
+// record returns the stored player, creating a fresh record for unknown PlayFab IDs
+func (b *Backend) record(playfabId string) *Player {
+	player, ok := b.players[playfabId]
+	if !ok {
+		player = &Player{
+			PlayfabId: playfabId,
+			Aliases:   make([]string, 0),
+			CreatedAt: time.Now().UTC().Truncate(time.Minute),
+			Platform:  "PC",
+		}
+		b.players[playfabId] = player
+	}
+	return player
+}
+
+// logWebhook prints the notification that was posted to the webhook
+func logWebhook(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil || !json.Valid(body) {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	log.Printf("webhook: %s", body)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJson(w http.ResponseWriter, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(data)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/charmbracelet/log"
+	"slices"
+	"time"
+)
+
+const journalFileName = "journal.json"
+
+// journalRetention is how long entries are kept in the saved journal, unless the undo window is longer
+const journalRetention = 24 * time.Hour
+
+// journalEntry is a global action that was sent from this client
+type journalEntry struct {
+	Number      int    `json:"number"`
+	Action      string `json:"action"`
+	PlayfabId   string `json:"playfab_id"`
+	DisplayName string `json:"display_name,omitempty"`
+	// Charges are the reasons of a ban, or the charges the player was wanted for when they were unbanned
+	Charges []string `json:"charges,omitempty"`
+	// ExpiresAt is when the trust of an untrusted player would have run out, so undoing the untrust keeps it
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	SentAt    time.Time  `json:"sent_at"`
+	// UndoOf is the number of the entry this action reverted
+	UndoOf int  `json:"undo_of,omitempty"`
+	Undone bool `json:"undone,omitempty"`
+}
+
+// inverse returns the action that reverts the entry
+func (entry journalEntry) inverse() (action string, params map[string]any, err error) {
+	switch entry.Action {
+	case "ban":
+		return "unban", nil, nil
+	case "unban":
+		if len(entry.Charges) == 0 {
+			return "", nil, errors.New("the charges of the previous ban are unknown, use banbyid instead")
+		}
+		return "ban", map[string]any{"charges": entry.Charges}, nil
+	case "trust":
+		return "untrust", nil, nil
+	case "untrust":
+		if entry.ExpiresAt != nil && time.Now().After(*entry.ExpiresAt) {
+			return "", nil, errors.New("the trust of the player ran out in the meantime")
+		}
+		return "trust", nil, nil
+	}
+	return "", nil, fmt.Errorf("%s can't be undone", entry.Action)
+}
+
+// actionJournal records the recent global actions, so that they can be undone. The journal is shared
+// with the ban, unban and trust commands of the command line, so it is read again before every change.
+type actionJournal struct {
+	// window is how long actions can be undone, 0 disables undo
+	window time.Duration
+	// persist is false for journals that only live in memory
+	persist bool
+	entries []journalEntry
+}
+
+func newActionJournal(window time.Duration) *actionJournal {
+	return &actionJournal{window: window}
+}
+
+// loadActionJournal reads the journal from the state dir
+func loadActionJournal(window time.Duration) (journal *actionJournal, err error) {
+	journal = newActionJournal(window)
+	journal.persist = true
+	err = journal.load()
+	return
+}
+
+// load picks up the actions that were sent by other instances of the tool
+func (journal *actionJournal) load() error {
+	if !journal.persist {
+		return nil
+	}
+	var entries []journalEntry
+	err := loadJson(journalFileName, &entries)
+	if err != nil {
+		return err
+	}
+	journal.entries = entries
+	return nil
+}
+
+// save drops the entries that are too old to be of interest and writes the journal
+func (journal *actionJournal) save() error {
+	if !journal.persist {
+		return nil
+	}
+	retention := max(journalRetention, journal.window)
+	journal.entries = slices.DeleteFunc(journal.entries, func(entry journalEntry) bool {
+		return time.Since(entry.SentAt) > retention
+	})
+	return saveJson(journalFileName, journal.entries)
+}
+
+// find returns the index of the entry with the given number
+func (journal *actionJournal) find(number int) (i int, ok bool) {
+	i = slices.IndexFunc(journal.entries, func(entry journalEntry) bool { return entry.Number == number })
+	return i, i >= 0
+}
+
+// record adds a sent action to the journal
+func (journal *actionJournal) record(action, playfabId, displayName string, charges []string, expiresAt *time.Time) (err error) {
+	err = journal.load()
+	number := 1
+	if len(journal.entries) > 0 {
+		number = journal.entries[len(journal.entries)-1].Number + 1
+	}
+	journal.entries = append(journal.entries, journalEntry{
+		Number:      number,
+		Action:      action,
+		PlayfabId:   playfabId,
+		DisplayName: displayName,
+		Charges:     charges,
+		ExpiresAt:   expiresAt,
+		SentAt:      time.Now(),
+	})
+	err = errors.Join(err, journal.save())
+	return
+}
+
+// undoable returns the entry with the given number if it can still be undone.
+// Number 0 selects the latest action of the admin that was not undone yet.
+func (journal *actionJournal) undoable(number int) (entry journalEntry, err error) {
+	if journal.window <= 0 {
+		return entry, errors.New("undo is disabled")
+	}
+	err = journal.load()
+	if err != nil {
+		return entry, fmt.Errorf("could not read the journal: %w", err)
+	}
+	if number == 0 {
+		for i := len(journal.entries) - 1; i >= 0; i-- {
+			if !journal.entries[i].Undone && journal.entries[i].UndoOf == 0 {
+				number = journal.entries[i].Number
+				break
+			}
+		}
+		if number == 0 {
+			return entry, errors.New("there is no action to undo")
+		}
+	}
+	i, ok := journal.find(number)
+	if !ok {
+		return entry, errors.New("invalid journal entry number")
+	}
+	entry = journal.entries[i]
+	if entry.Undone {
+		return entry, fmt.Errorf("action %d was already undone", number)
+	}
+	age := time.Since(entry.SentAt)
+	if age > journal.window {
+		return entry, fmt.Errorf("action %d was sent %s ago, actions can only be undone within %s", number, formatAge(age), formatAge(journal.window))
+	}
+	return entry, nil
+}
+
+// markUndone marks an entry as undone by the latest entry with the inverse action for the same player
+func (journal *actionJournal) markUndone(number int, inverse string) error {
+	err := journal.load()
+	i, ok := journal.find(number)
+	if !ok {
+		return errors.Join(err, fmt.Errorf("journal entry %d not found", number))
+	}
+	journal.entries[i].Undone = true
+	for j := len(journal.entries) - 1; j > i; j-- {
+		if journal.entries[j].Action == inverse && journal.entries[j].PlayfabId == journal.entries[i].PlayfabId {
+			journal.entries[j].UndoOf = number
+			break
+		}
+	}
+	return errors.Join(err, journal.save())
+}
+
+// list returns all entries, oldest first
+func (journal *actionJournal) list() []journalEntry {
+	err := journal.load()
+	if err != nil {
+		log.Warn("Failed to read the journal, showing the actions of this session", "err", err)
+	}
+	return journal.entries
+}
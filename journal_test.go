@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"maps"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJournalInverse(t *testing.T) {
+	future, past := time.Now().Add(time.Hour), time.Now().Add(-time.Hour)
+	tests := []struct {
+		name    string
+		entry   journalEntry
+		inverse string
+		params  map[string]any
+		// err is part of the expected error, empty if the entry can be undone
+		err string
+	}{
+		{"ban", journalEntry{Action: "ban", Charges: []string{"spam"}}, "unban", nil, ""},
+		{"unban", journalEntry{Action: "unban", Charges: []string{"spam"}}, "ban", map[string]any{"charges": []string{"spam"}}, ""},
+		{"unban without charges", journalEntry{Action: "unban"}, "", nil, "charges of the previous ban are unknown"},
+		{"trust", journalEntry{Action: "trust"}, "untrust", nil, ""},
+		{"untrust", journalEntry{Action: "untrust"}, "trust", nil, ""},
+		{"untrust of a running trust", journalEntry{Action: "untrust", ExpiresAt: &future}, "trust", nil, ""},
+		{"untrust of a trust that ran out", journalEntry{Action: "untrust", ExpiresAt: &past}, "", nil, "ran out"},
+		{"kick", journalEntry{Action: "kick"}, "", nil, "can't be undone"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			inverse, params, err := test.entry.inverse()
+			switch {
+			case test.err == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+				t.Fatalf("error = %v, want it to contain %q", err, test.err)
+			}
+			if inverse != test.inverse || !maps.EqualFunc(params, test.params, func(a, b any) bool {
+				return strings.Join(a.([]string), " ") == strings.Join(b.([]string), " ")
+			}) {
+				t.Errorf("inverse = %s %v, want %s %v", inverse, params, test.inverse, test.params)
+			}
+		})
+	}
+}
+
+func TestJournalUndoable(t *testing.T) {
+	now := time.Now()
+	entries := []journalEntry{
+		{Number: 1, Action: "ban", SentAt: now.Add(-2 * time.Hour)},
+		{Number: 2, Action: "trust", SentAt: now.Add(-time.Minute), Undone: true},
+		{Number: 3, Action: "ban", SentAt: now.Add(-time.Minute)},
+		{Number: 4, Action: "untrust", SentAt: now, UndoOf: 2},
+	}
+	tests := []struct {
+		name   string
+		window time.Duration
+		number int
+		want   int
+		// err is part of the expected error, empty if the entry can be undone
+		err string
+	}{
+		{"latest", time.Hour, 0, 3, ""},
+		{"by number", time.Hour, 4, 4, ""},
+		{"already undone", time.Hour, 2, 0, "already undone"},
+		{"outside the window", time.Hour, 1, 0, "can only be undone within 1h"},
+		{"unknown number", time.Hour, 9, 0, "invalid journal entry number"},
+		{"disabled", 0, 0, 0, "undo is disabled"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			journal := newActionJournal(test.window)
+			journal.entries = entries
+			entry, err := journal.undoable(test.number)
+			switch {
+			case test.err == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+				t.Fatalf("error = %v, want it to contain %q", err, test.err)
+			case test.err == "" && entry.Number != test.want:
+				t.Errorf("entry = %d, want %d", entry.Number, test.want)
+			}
+		})
+	}
+}
+
+func TestJournalMarkUndone(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	journal, err := loadActionJournal(time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, action := range []string{"ban", "unban", "ban", "unban"} {
+		err = journal.record(action, "AAAA000000000001", "Bob", []string{"spam"}, nil)
+		if err != nil {
+			t.Fatalf("record failed: %v", err)
+		}
+	}
+	err = journal.markUndone(1, "unban")
+	if err != nil {
+		t.Fatalf("markUndone failed: %v", err)
+	}
+	// The journal is shared with other instances, so the changes have to be saved
+	loaded, _ := loadActionJournal(time.Hour)
+	entries := loaded.list()
+	if len(entries) != 4 || !entries[0].Undone || entries[3].UndoOf != 1 || entries[1].UndoOf != 0 {
+		t.Errorf("entries = %+v, want the first ban undone by the latest unban", entries)
+	}
+}
+
+// TestUndoUntrustKeepsExpiry makes sure that undoing an untrust trusts the player until the old trust ran out
+func TestUndoUntrustKeepsExpiry(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	trust := newTrustList("admin")
+	clipboardEvents, commandEvents := newFakeEvents(), newFakeEvents()
+	options := appOptions{trust: trust, confirm: confirmNever, journal: newActionJournal(time.Hour)}
+	out := &syncBuffer{}
+	app := newApp(newTestService(t, newTestBackend()), clipboardEvents, commandEvents, &fakeClipboard{}, out, options)
+	done := make(chan struct{})
+	go func() {
+		app.Run(context.Background())
+		close(done)
+	}()
+
+	clipboardEvents.Send(testDump)
+	waitFor(t, "the player table", func() bool { return strings.Contains(out.String(), "Alice") })
+	// Trust Bob for a week, undo it, and undo the untrust of the undo
+	for _, command := range []string{"trust 2 7d", "undo", "undo 2"} {
+		commandEvents.Send(command)
+	}
+	commandEvents.Close()
+	<-done
+
+	entries := trust.list()
+	if len(entries) != 1 || entries[0].ExpiresAt == nil {
+		t.Fatalf("trust list = %+v, want Bob with an expiry", entries)
+	}
+	if left := time.Until(*entries[0].ExpiresAt); left < 7*24*time.Hour-time.Minute || left > 7*24*time.Hour {
+		t.Errorf("trust runs out in %v, want a week", left)
+	}
+}
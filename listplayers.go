@@ -1,33 +1,166 @@
 package main
 
-import "strings"
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
 
 const (
-	delimiter = " - "
+	delimiter    = " - "
+	headerPrefix = "ServerName" + delimiter
+)
+
+var (
+	errMissingHeader    = errors.New("missing ServerName header")
+	errEmptyServerName  = errors.New("empty server name")
+	errMissingColumns   = errors.New("missing column header line")
+	errMissingPlayfabId = errors.New("column header has no PlayFabID column")
+	errColumnCount      = errors.New("row has fewer columns than the column header")
 )
 
-// readPlayerList extracts all player information from the listplayers output
+// ParseError identifies the line of a listplayers output that could not be parsed
+type ParseError struct {
+	// Line is the 1-based line number
+	Line int
+	Text string
+	Err  error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %v: %q", e.Line, e.Err, e.Text)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// readPlayerList extracts all player information from the listplayers output.
+// The output starts with the server name, followed by a line of column names and one line per player.
+// Rows that can't be parsed are skipped and reported in the returned error,
+// so a truncated paste still yields all complete rows.
 func readPlayerList(list string) (serverName string, players []connectedPlayer, err error) {
 	lines := strings.Split(strings.ReplaceAll(list, "\r\n", "\n"), "\n")
-	cutStart := strings.Index(lines[0], delimiter) + 3
-	cutEnd := strings.LastIndex(lines[0], " ")
-	serverName = lines[0][cutStart:cutEnd]
 
+	// Server name header
+	if !strings.HasPrefix(lines[0], headerPrefix) {
+		err = &ParseError{Line: 1, Text: lines[0], Err: errMissingHeader}
+		return
+	}
+	serverName = strings.TrimPrefix(lines[0], headerPrefix)
+	// The last space separated part of the header is not part of the server name
+	cutEnd := strings.LastIndex(serverName, " ")
+	if cutEnd >= 0 {
+		serverName = serverName[:cutEnd]
+	}
+	serverName = strings.TrimSpace(serverName)
+	if serverName == "" {
+		err = &ParseError{Line: 1, Text: lines[0], Err: errEmptyServerName}
+		return
+	}
+
+	// Column header
+	if len(lines) < 2 || strings.TrimSpace(lines[1]) == "" {
+		err = &ParseError{Line: 2, Err: errMissingColumns}
+		return
+	}
+	columns := strings.Split(strings.TrimSpace(lines[1]), delimiter)
+	playfabColumn := -1
+	for i, column := range columns {
+		if i > 0 && normalizeColumnName(column) == "playfabid" {
+			playfabColumn = i
+		}
+	}
+	if playfabColumn == -1 {
+		err = &ParseError{Line: 2, Text: lines[1], Err: errMissingPlayfabId}
+		return
+	}
+
+	// Player rows. The display name comes first and may contain the delimiter itself,
+	// so the other columns are counted from the end of the line.
 	players = make([]connectedPlayer, 0, len(lines)-2)
-	for _, line := range lines[2:] {
-		if line == "" {
+	rowErrors := make([]error, 0)
+	for i, line := range lines[2:] {
+		if strings.TrimSpace(line) == "" {
 			continue
 		}
 		split := strings.Split(line, delimiter)
-		displayName := strings.Join(split[:len(split)-5], delimiter)
-		playfabId := split[len(split)-5]
-		if playfabId == "NULL" {
+		if len(split) < len(columns) {
+			rowErrors = append(rowErrors, &ParseError{Line: i + 3, Text: line, Err: errColumnCount})
 			continue
 		}
-		players = append(players, connectedPlayer{
-			DisplayName: displayName,
-			PlayfabId:   playfabId,
-		})
+		nameEnd := len(split) - len(columns) + 1
+		player := connectedPlayer{
+			DisplayName: strings.Join(split[:nameEnd], delimiter),
+			PlayfabId:   strings.TrimSpace(split[nameEnd+playfabColumn-1]),
+			Columns:     make([]playerColumn, 0, len(columns)-1),
+		}
+		if player.PlayfabId == "NULL" || player.PlayfabId == "" {
+			// Bots have no PlayFab ID
+			continue
+		}
+		for j, column := range columns[1:] {
+			player.setColumn(strings.TrimSpace(column), strings.TrimSpace(split[nameEnd+j]))
+		}
+		players = append(players, player)
+	}
+	err = errors.Join(rowErrors...)
+	return
+}
+
+// splitPlayerLists finds every listplayers output in a text, like a server log or a chat message.
+// Each output starts at a ServerName header and lasts until the next one. Text before the first header is ignored.
+func splitPlayerLists(text string) (lists []string) {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	start := -1
+	for i, line := range lines {
+		// Only leading spaces are removed, the end of the header is cut off by readPlayerList
+		line = strings.TrimLeft(line, " \t")
+		if !strings.HasPrefix(line, headerPrefix) {
+			continue
+		}
+		if start >= 0 {
+			lists = append(lists, strings.Join(lines[start:i], "\n"))
+		}
+		lines[i] = line
+		start = i
+	}
+	if start >= 0 {
+		lists = append(lists, strings.Join(lines[start:], "\n"))
 	}
 	return
 }
+
+// setColumn stores a listplayers column and fills the matching field for columns that are known
+func (player *connectedPlayer) setColumn(name, value string) {
+	player.Columns = append(player.Columns, playerColumn{Name: name, Value: value})
+	number := func() *int {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil
+		}
+		return &n
+	}
+	switch normalizeColumnName(name) {
+	case "eosid", "epicid":
+		player.EosId = value
+	case "team", "teamid":
+		player.Team = value
+	case "score":
+		player.Score = number()
+	case "kills":
+		player.Kills = number()
+	case "deaths":
+		player.Deaths = number()
+	case "ping":
+		player.Ping = number()
+	}
+}
+
+// normalizeColumnName makes column names comparable regardless of case and spacing
+func normalizeColumnName(column string) string {
+	column = strings.ToLower(column)
+	column = strings.NewReplacer(" ", "", "_", "", "-", "").Replace(column)
+	return column
+}
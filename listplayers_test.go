@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+const testPlayerList = "ServerName - DEFSAK Test 123\n" +
+	"Name - PlayFabID - EOSID - Team - Score - Kills - Deaths - Ping\n" +
+	"Alice - Smith - AAAA000000000002 - eos2 - 1 - 115 - 11 - 1 - 20\n" +
+	"Bob - AAAA000000000001 - eos1 - 0 - 10 - 2 - 3 - 40\n" +
+	"Bot - NULL - NULL - 0 - 0 - 0 - 0 - 0\n"
+
+func TestReadPlayerList(t *testing.T) {
+	tests := []struct {
+		name       string
+		list       string
+		serverName string
+		// names are the display names of the players that were read
+		names []string
+	}{
+		{"players and bots", testPlayerList, "DEFSAK Test", []string{"Alice - Smith", "Bob"}},
+		{"windows line endings", "ServerName - Test 1\r\nName - PlayFabID\r\nBob - AAAA000000000001\r\n", "Test", []string{"Bob"}},
+		{"no players", "ServerName - Test 1\nName - PlayFabID\n", "Test", []string{}},
+		{"playfab id not second", "ServerName - Test 1\nName - Team - PlayFabID\nA - B - 0 - AAAA000000000001\n", "Test", []string{"A - B"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			serverName, players, err := readPlayerList(test.list)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if serverName != test.serverName {
+				t.Errorf("server name = %q, want %q", serverName, test.serverName)
+			}
+			names := make([]string, 0, len(players))
+			for _, player := range players {
+				names = append(names, player.DisplayName)
+			}
+			if !slices.Equal(names, test.names) {
+				t.Errorf("players = %q, want %q", names, test.names)
+			}
+		})
+	}
+}
+
+func TestReadPlayerListColumns(t *testing.T) {
+	_, players, err := readPlayerList(testPlayerList)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	alice := players[0]
+	if alice.PlayfabId != "AAAA000000000002" || alice.EosId != "eos2" || alice.Team != "1" {
+		t.Errorf("Alice = %+v, want PlayFab ID, EOS ID and team of the row", alice)
+	}
+	if alice.Score == nil || *alice.Score != 115 || alice.Ping == nil || *alice.Ping != 20 {
+		t.Errorf("Alice = %+v, want score 115 and ping 20", alice)
+	}
+	if len(alice.Columns) != 7 || alice.Columns[0] != (playerColumn{"PlayFabID", "AAAA000000000002"}) {
+		t.Errorf("columns = %v, want every column after the name", alice.Columns)
+	}
+}
+
+func TestReadPlayerListErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		list string
+		err  error
+		line int
+		// players is the number of rows that are still read
+		players int
+	}{
+		{"missing header", "Name - PlayFabID\nBob - AAAA000000000001\n", errMissingHeader, 1, 0},
+		{"empty server name", "ServerName -  123\nName - PlayFabID\n", errEmptyServerName, 1, 0},
+		{"missing column header", "ServerName - Test 1", errMissingColumns, 2, 0},
+		{"empty column header", "ServerName - Test 1\n\nBob - AAAA000000000001\n", errMissingColumns, 2, 0},
+		{"missing playfab id column", "ServerName - Test 1\nName - EOSID\nBob - eos1\n", errMissingPlayfabId, 2, 0},
+		{"playfab id as name column", "ServerName - Test 1\nPlayFabID - Name\n", errMissingPlayfabId, 2, 0},
+		{"short row", "ServerName - Test 1\nName - PlayFabID - Score\nBob - AAAA000000000001\nAlice - AAAA000000000002 - 5\n", errColumnCount, 3, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, players, err := readPlayerList(test.list)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("error = %v, want %v", err, test.err)
+			}
+			var parseErr *ParseError
+			if !errors.As(err, &parseErr) || parseErr.Line != test.line {
+				t.Errorf("error = %v, want a ParseError in line %d", err, test.line)
+			}
+			if len(players) != test.players {
+				t.Errorf("read %d players, want %d", len(players), test.players)
+			}
+		})
+	}
+}
+
+func TestSplitPlayerLists(t *testing.T) {
+	text := "chat message\n" + testPlayerList + "  ServerName - Other 1\nName - PlayFabID\n"
+	lists := splitPlayerLists(text)
+	if len(lists) != 2 {
+		t.Fatalf("found %d lists, want 2: %q", len(lists), lists)
+	}
+	serverName, _, err := readPlayerList(lists[1])
+	if err != nil || serverName != "Other" {
+		t.Errorf("second list has server %q and error %v, want server %q", serverName, err, "Other")
+	}
+}
+
+// FuzzReadPlayerList makes sure that no input makes the parser panic and that it never returns bots
+func FuzzReadPlayerList(f *testing.F) {
+	f.Add(testPlayerList)
+	f.Add("ServerName - Test 1\nName - PlayFabID - Score\nBob - AAAA000000000001\n")
+	f.Add("ServerName - \n - PlayFabID\n - \n")
+	f.Add("")
+	f.Fuzz(func(t *testing.T, list string) {
+		_, players, _ := readPlayerList(list)
+		for _, player := range players {
+			if player.PlayfabId == "" || player.PlayfabId == "NULL" {
+				t.Errorf("player without PlayFab ID: %+v", player)
+			}
+		}
+	})
+}
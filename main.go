@@ -2,11 +2,15 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"github.com/charmbracelet/lipgloss"
 	"github.com/charmbracelet/log"
+	"io"
 	"os"
 	"os/signal"
-	"strings"
+	"os/user"
 	"time"
 )
 
@@ -21,7 +25,7 @@ func main() {
 			log.Info("If this error persists please create a bug report")
 			fmt.Println("Press Ctrl-C or close this window...")
 			<-interrupts
-			os.Exit(1)
+			os.Exit(exitError)
 		}
 	}()
 
@@ -29,64 +33,157 @@ func main() {
 	log.SetFormatter(log.TextFormatter)
 	log.SetReportCaller(false)
 
-	// Make sure the user has credentials
-	credentialPath, err := setupCredentials()
+	// Read settings from the config file, environment and flags
+	cfg, args, err := loadConfig(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 	if err != nil {
-		log.Error("Credential setup failed")
-		panic(err)
+		log.Error("Invalid configuration", "err", err)
+		os.Exit(exitUsage)
 	}
 
-	// Login to backend
-	svc, err := newBackendService(credentialPath)
+	// Earlier versions saved their files next to the credentials
+	err = migrateState()
 	if err != nil {
-		log.Error("Login to backend failed")
-		panic(err)
+		log.Warn("Failed to move saved files to the state dir", "err", err)
 	}
 
-	// Setup watchers for commands and clipboard copy operations
-	ctx, cancelWatchers := context.WithCancel(context.Background())
-	clipboardEvents := watchClipboard(ctx, time.Millisecond*50)
-	stdinEvents := watchStdin(ctx)
+	// Without a subcommand the tool watches the clipboard like it always did
+	name := "watch"
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	cmd, ok := findSubcommand(name)
+	if !ok {
+		log.Error("Unknown command, use -h to list all commands", "command", name)
+		os.Exit(exitUsage)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	exitCode := cmd.run(ctx, cfg, cmd.newFlags(), args)
+	cancel()
+	os.Exit(exitCode)
+}
+
+// runWatch validates every player list that is copied to the clipboard and reads commands from the console
+func runWatch(ctx context.Context, cfg config, flags *flag.FlagSet, args []string) (exitCode int) {
+	exitCode, ok := parseSubcommand(flags, args, 0, 0)
+	if !ok {
+		return
+	}
+
+	// Setup watchers for commands and clipboard copy operations.
+	// Output goes through the console, so it doesn't break the line that is being typed.
+	console := newConsole()
+	defer console.close()
+	app := setupApp(ctx, cfg, console, console.writer(os.Stdout), nil)
+	console.complete = app.completeCommand
+	app.showServer = console.setServer
+	log.SetColorProfile(lipgloss.ColorProfile())
+	log.SetOutput(console.writer(os.Stderr))
+	defer log.SetOutput(os.Stderr)
 
 	// Start the main loop
 	log.Info("Chiv admin helper is ready to use")
 	log.Info("Use the listplayers command in game to validate players. Press Ctrl+C to abort")
-	validatedPlayers := make([]validatedPlayer, 0)
-mainLoop:
-	for {
-		select {
-		case event := <-stdinEvents:
-			// Process commands when received
-			inGameCommand, err := executeCommand(event, validatedPlayers, svc)
-			if err != nil {
-				log.Warn("Failed to execute command", "err", err)
-				continue mainLoop
-			}
-			if inGameCommand != "" {
-				err = writeClipboardString(inGameCommand)
-				if err != nil {
-					log.Warn("Failed to write command to clipboard", "err", err)
-				} else {
-					log.Info("In-game command was copied to clipboard", "command", inGameCommand)
-				}
-			}
-		case event := <-clipboardEvents:
-			// Validate player list from clipboard
-			if strings.HasPrefix(event, "ServerName - ") {
-				serverName, players, err := readPlayerList(event)
-				if err != nil {
-					log.Warn("Failed to read player list", "err", err)
-					continue mainLoop
-				}
-				validatedPlayers, _ = svc.validatePlayers(serverName, players)
-				log.Info("Validated players", "count", len(validatedPlayers))
-				printTable(validatedPlayers)
-			}
-		case <-interrupts:
-			// Close program
-			cancelWatchers()
-			time.Sleep(time.Millisecond)
-			break mainLoop
+	app.Run(ctx)
+	// Give the watchers a moment to shut down
+	time.Sleep(time.Millisecond)
+	return exitOk
+}
+
+// setupApp connects to the backend and the clipboard and loads the local state for the interactive modes.
+// Setup errors are fatal.
+func setupApp(ctx context.Context, cfg config, commandEvents EventSource, out io.Writer, view PlayerView) *App {
+	// Make sure the user has credentials and login to backend
+	svc, credentialPath, err := connectBackend(cfg)
+	if err != nil {
+		panic(err)
+	}
+
+	// Connect to the system clipboard
+	clipboard, err := newClipboardBackend(ctx)
+	if err != nil {
+		log.Error("Clipboard setup failed")
+		panic(err)
+	}
+
+	// Load previous validation results
+	options := appOptions{
+		format:        cfg.OutputFormat,
+		view:          view,
+		confirm:       cfg.ConfirmActions,
+		undoWindow:    time.Duration(cfg.UndoWindow),
+		notifications: newNotificationRouter(cfg),
+	}
+	if cfg.CacheMaxAge > 0 {
+		options.cache, err = loadValidationCache(time.Duration(cfg.CacheMaxAge))
+		if err != nil {
+			log.Warn("Failed to load validation cache, starting with an empty cache", "err", err)
+		}
+	}
+
+	// Keep the local wanted board mirror up to date
+	if cfg.WantedSync > 0 {
+		options.wantedBoard, err = loadWantedBoard(time.Duration(cfg.WantedSync))
+		if err != nil {
+			log.Warn("Failed to load wanted board mirror, starting with a full sync", "err", err)
 		}
+		go options.wantedBoard.syncLoop(ctx, svc)
+	}
+
+	// Fetch the predefined ban charges, until then the last known or the shipped charges are used
+	options.charges, err = loadChargeCatalogue()
+	if err != nil {
+		log.Warn("Failed to load ban charges, using the shipped charges", "err", err)
+	}
+	go options.charges.refresh(ctx, svc)
+
+	// Load the players that were trusted from this client
+	options.trust = loadLocalTrust(cfg, credentialPath)
+
+	// Actions sent in an earlier session or with the command line can still be undone
+	options.journal, err = loadActionJournal(options.undoWindow)
+	if err != nil {
+		log.Warn("Failed to load the journal, starting with an empty journal", "err", err)
+	}
+
+	return newApp(actionService(cfg, svc), clipboardSource{clipboard, clipboardPollInterval}, commandEvents, clipboard, out, options)
+}
+
+// connectBackend sets up the credentials if the auth mode needs them and logs in to the backend
+func connectBackend(cfg config) (svc backendService, credentialPath string, err error) {
+	if cfg.AuthMode == authIdToken {
+		credentialPath, err = setupCredentials()
+		if err != nil {
+			log.Error("Credential setup failed")
+			return
+		}
+	}
+	svc, err = newBackendService(cfg, credentialPath)
+	if err != nil {
+		log.Error("Login to backend failed")
+	}
+	return
+}
+
+// loadLocalTrust loads the trust list, attributing new entries to the configured admin name,
+// the account of the credentials or the system user
+func loadLocalTrust(cfg config, credentialPath string) *trustList {
+	admin := cfg.AdminName
+	if admin == "" {
+		admin = credentialsIdentity(credentialPath)
+	}
+	if admin == "" {
+		systemUser, err := user.Current()
+		if err == nil {
+			admin = systemUser.Username
+		}
+	}
+	trust, err := loadTrustList(admin)
+	if err != nil {
+		log.Warn("Failed to load local trust list, starting with an empty list", "err", err)
 	}
+	return trust
 }
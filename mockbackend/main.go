@@ -0,0 +1,38 @@
+// Command mockbackend is a local stand-in for the validate_players, player_action, lookup_players, wanted_board_sync
+// and ban_charges cloud functions. It also accepts notifications at /webhook and logs them.
+//
+// Run it with `go run ./mockbackend` and point the helper at it with
+// `chiv-admin-helper -backend-url http://127.0.0.1:8080 -auth none`.
+// Add `-discord-webhook http://127.0.0.1:8080/webhook` or `-webhook-url http://127.0.0.1:8080/webhook` to test notifications.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"github.com/DEFSAK/chiv-admin-helper/internal/mockbackend"
+	"log"
+	"net/http"
+	"os"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:8080", "address to listen on")
+	fixture := flag.String("players", "", "JSON file with a list of player records to preload")
+	token := flag.String("token", "", "require this bearer token on every request")
+	flag.Parse()
+
+	var players []mockbackend.Player
+	if *fixture != "" {
+		data, err := os.ReadFile(*fixture)
+		if err != nil {
+			log.Fatalf("could not read fixture: %v", err)
+		}
+		err = json.Unmarshal(data, &players)
+		if err != nil {
+			log.Fatalf("could not parse fixture: %v", err)
+		}
+	}
+
+	log.Printf("mock backend listening on http://%s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, mockbackend.New(*token, players)))
+}
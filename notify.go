@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/charmbracelet/log"
+	"github.com/gen2brain/beeep"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Events that notifications can be configured for
+const (
+	// eventWanted is raised when a wanted player is seen on a server for the first time
+	eventWanted = "wanted_player"
+	// eventSuspicious is raised when a suspicious player is seen on a server for the first time
+	eventSuspicious = "suspicious_player"
+	// eventBan is raised when a player was banned from this client
+	eventBan = "ban"
+	// eventBatch is the event of notifications that were sent together
+	eventBatch = "batch"
+)
+
+var notificationEvents = []string{eventWanted, eventSuspicious, eventBan}
+
+// notifierNames are the notifiers that events can be sent to
+var notifierNames = []string{"bell", "desktop", "discord", "webhook"}
+
+// localNotifiers only tell the admin at this computer
+var localNotifiers = []string{"bell", "desktop"}
+
+// notification describes an event. Generic webhooks receive it as JSON.
+type notification struct {
+	Event       string    `json:"event"`
+	Title       string    `json:"title"`
+	Message     string    `json:"message"`
+	ServerName  string    `json:"server_name,omitempty"`
+	PlayfabId   string    `json:"playfab_id,omitempty"`
+	DisplayName string    `json:"display_name,omitempty"`
+	Charges     []string  `json:"charges,omitempty"`
+	Admin       string    `json:"admin,omitempty"`
+	Time        time.Time `json:"time"`
+	// Batch holds the notifications that were sent together, because they happened within the notify interval
+	Batch []notification `json:"batch,omitempty"`
+	// Local is set for alerts about records that might be outdated, they are not sent to the team
+	Local bool `json:"-"`
+}
+
+// Notifier tells the admin or their team about an event
+type Notifier interface {
+	Notify(ctx context.Context, n notification) error
+}
+
+// bellNotifier plays the alert sound
+type bellNotifier struct{}
+
+func (bellNotifier) Notify(ctx context.Context, n notification) error {
+	return beeep.Beep(beeep.DefaultFreq, 100)
+}
+
+// desktopNotifier shows a notification on the desktop
+type desktopNotifier struct{}
+
+func (desktopNotifier) Notify(ctx context.Context, n notification) error {
+	return beeep.Notify(n.Title, n.Message, "")
+}
+
+// discordMessageLimit is the maximum length of a Discord message
+const discordMessageLimit = 2000
+
+// discordMessage is the payload of a Discord webhook
+type discordMessage struct {
+	Username string `json:"username"`
+	Content  string `json:"content"`
+	// AllowedMentions keeps player names like @everyone from pinging the channel
+	AllowedMentions struct {
+		Parse []string `json:"parse"`
+	} `json:"allowed_mentions"`
+}
+
+// webhookNotifier posts notifications to a URL. Discord webhooks receive a chat message,
+// other webhooks receive the notification as JSON.
+type webhookNotifier struct {
+	url     string
+	discord bool
+	client  *http.Client
+}
+
+func (webhook webhookNotifier) Notify(ctx context.Context, n notification) error {
+	var payload any = n
+	if webhook.discord {
+		payload = newDiscordMessage(n)
+	}
+	body, _ := json.Marshal(payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid webhook URL: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := webhook.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with %s", resp.Status)
+	}
+	return nil
+}
+
+// newDiscordMessage formats a notification as a Discord message
+func newDiscordMessage(n notification) (message discordMessage) {
+	message.Username = confNamespace
+	message.Content = "**" + escapeMarkdown(n.Title) + "**\n" + escapeMarkdown(n.Message)
+	if utf8.RuneCountInString(message.Content) > discordMessageLimit {
+		message.Content = string([]rune(message.Content)[:discordMessageLimit-1]) + "…"
+	}
+	message.AllowedMentions.Parse = []string{}
+	return
+}
+
+// notificationRouter sends every event to the notifiers that are configured for it.
+// Every notifier is sent at most one notification per interval, events in between are sent together,
+// so a lobby full of wanted players doesn't turn into noise or get rate limited by Discord.
+type notificationRouter struct {
+	timeout time.Duration
+	// interval is the minimum time between two notifications of a notifier, 0 sends every event right away
+	interval  time.Duration
+	routes    map[string][]string
+	notifiers map[string]Notifier
+
+	lock   sync.Mutex
+	queues map[string]*notificationQueue
+	// sending counts the notifications that are still being sent
+	sending sync.WaitGroup
+}
+
+// notificationQueue holds the events of a notifier that wait for the interval to pass
+type notificationQueue struct {
+	lastSent time.Time
+	pending  []notification
+	timer    *time.Timer
+}
+
+// newNotificationRouter sets up the notifiers of the config
+func newNotificationRouter(cfg config) *notificationRouter {
+	router := &notificationRouter{
+		timeout:  time.Duration(cfg.RequestTimeout),
+		interval: time.Duration(cfg.AlertInterval),
+		routes:   cfg.Notify,
+		notifiers: map[string]Notifier{
+			"bell":    bellNotifier{},
+			"desktop": desktopNotifier{},
+		},
+	}
+	if cfg.DiscordWebhook != "" {
+		router.notifiers["discord"] = webhookNotifier{url: cfg.DiscordWebhook, discord: true, client: &http.Client{}}
+	}
+	if cfg.WebhookUrl != "" {
+		router.notifiers["webhook"] = webhookNotifier{url: cfg.WebhookUrl, client: &http.Client{}}
+	}
+	return router
+}
+
+// notify sends the notification in the background, or queues it until the interval of the notifier passed.
+// Failures are only logged, they never block the admin.
+func (router *notificationRouter) notify(n notification) {
+	if n.Time.IsZero() {
+		n.Time = time.Now()
+	}
+	router.lock.Lock()
+	defer router.lock.Unlock()
+	if router.queues == nil {
+		router.queues = make(map[string]*notificationQueue)
+	}
+	for _, name := range router.routes[n.Event] {
+		_, ok := router.notifiers[name]
+		if !ok || (n.Local && !slices.Contains(localNotifiers, name)) {
+			continue
+		}
+		queue, ok := router.queues[name]
+		if !ok {
+			queue = &notificationQueue{}
+			router.queues[name] = queue
+		}
+		queue.pending = append(queue.pending, n)
+		if queue.timer != nil {
+			// The queue is already waiting for the interval to pass
+			continue
+		}
+		delay := router.interval - time.Since(queue.lastSent)
+		if queue.lastSent.IsZero() || delay <= 0 {
+			router.flush(name)
+			continue
+		}
+		queue.timer = time.AfterFunc(delay, func() {
+			router.lock.Lock()
+			defer router.lock.Unlock()
+			router.flush(name)
+		})
+	}
+}
+
+// flush sends the queued events of a notifier as a single notification. The lock must be held.
+func (router *notificationRouter) flush(name string) {
+	queue := router.queues[name]
+	if queue.timer != nil {
+		queue.timer.Stop()
+		queue.timer = nil
+	}
+	if len(queue.pending) == 0 {
+		return
+	}
+	n := mergeNotifications(queue.pending)
+	queue.pending = nil
+	queue.lastSent = time.Now()
+	notifier := router.notifiers[name]
+	router.sending.Add(1)
+	go func() {
+		defer router.sending.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), router.timeout)
+		defer cancel()
+		err := notifier.Notify(ctx, n)
+		if err != nil {
+			log.Warn("Failed to send notification", "notifier", name, "event", n.Event, "err", err)
+		}
+	}()
+}
+
+// wait sends the queued events right away and blocks until all notifications were sent,
+// so they are not lost when the tool exits
+func (router *notificationRouter) wait() {
+	router.lock.Lock()
+	for name := range router.queues {
+		router.flush(name)
+	}
+	router.lock.Unlock()
+	router.sending.Wait()
+}
+
+// mergeNotifications combines events into a single notification that lists all of them
+func mergeNotifications(events []notification) notification {
+	if len(events) == 1 {
+		return events[0]
+	}
+	lines := make([]string, 0, len(events))
+	for _, event := range events {
+		lines = append(lines, event.Title+": "+event.Message)
+	}
+	return notification{
+		Event:   eventBatch,
+		Title:   fmt.Sprintf("%d notifications", len(events)),
+		Message: strings.Join(lines, "\n"),
+		Time:    events[len(events)-1].Time,
+		Batch:   slices.Clone(events),
+	}
+}
+
+// parseNotifyRoutes reads the notifiers of events from text like "wanted_player=bell,discord;ban=discord".
+// An event without notifiers turns its notifications off.
+func parseNotifyRoutes(text string) (routes map[string][]string, err error) {
+	routes = make(map[string][]string)
+	for _, route := range strings.Split(text, ";") {
+		if strings.TrimSpace(route) == "" {
+			continue
+		}
+		event, names, ok := strings.Cut(route, "=")
+		if !ok {
+			return nil, fmt.Errorf("expected event=notifiers, got %q", route)
+		}
+		notifiers := make([]string, 0)
+		for _, name := range strings.Split(names, ",") {
+			name = strings.TrimSpace(name)
+			if name != "" {
+				notifiers = append(notifiers, name)
+			}
+		}
+		routes[strings.TrimSpace(event)] = notifiers
+	}
+	return
+}
+
+// checkNotifyRoutes makes sure that every event and notifier exists and that webhooks have a URL
+func checkNotifyRoutes(cfg config) error {
+	for event, names := range cfg.Notify {
+		if !slices.Contains(notificationEvents, event) {
+			return fmt.Errorf("unknown notification event %q, expected one of %s", event, strings.Join(notificationEvents, ", "))
+		}
+		for _, name := range names {
+			switch {
+			case !slices.Contains(notifierNames, name):
+				return fmt.Errorf("unknown notifier %q, expected one of %s", name, strings.Join(notifierNames, ", "))
+			case name == "discord" && cfg.DiscordWebhook == "":
+				return errors.New("the discord notifier requires a discord webhook URL")
+			case name == "webhook" && cfg.WebhookUrl == "":
+				return errors.New("the webhook notifier requires a webhook URL")
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// webhookServer stores the body of the last request it received
+func webhookServer(t *testing.T, status int) (url string, body func() []byte) {
+	t.Helper()
+	received := make(chan []byte, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("got %s request with content type %q, want a JSON POST", r.Method, r.Header.Get("Content-Type"))
+		}
+		data, _ := io.ReadAll(r.Body)
+		received <- data
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, func() []byte {
+		select {
+		case data := <-received:
+			return data
+		default:
+			t.Fatal("webhook received no request")
+			return nil
+		}
+	}
+}
+
+var testNotification = notification{
+	Event:       eventWanted,
+	Title:       "Wanted player on DEFSAK Test",
+	Message:     "@everyone *Alice* (AAAA000000000002) is wanted for cheating",
+	ServerName:  "DEFSAK Test",
+	PlayfabId:   "AAAA000000000002",
+	DisplayName: "@everyone *Alice*",
+	Charges:     []string{"cheating"},
+	Time:        time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+}
+
+func TestDiscordWebhook(t *testing.T) {
+	url, body := webhookServer(t, http.StatusNoContent)
+	webhook := webhookNotifier{url: url, discord: true, client: http.DefaultClient}
+	err := webhook.Notify(context.Background(), testNotification)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var message struct {
+		Username        string `json:"username"`
+		Content         string `json:"content"`
+		AllowedMentions *struct {
+			Parse []string `json:"parse"`
+		} `json:"allowed_mentions"`
+	}
+	err = json.Unmarshal(body(), &message)
+	if err != nil {
+		t.Fatalf("invalid Discord payload: %v", err)
+	}
+	wantContent := "**Wanted player on DEFSAK Test**\n@everyone \\*Alice\\* (AAAA000000000002) is wanted for cheating"
+	if message.Content != wantContent {
+		t.Errorf("content = %q, want %q", message.Content, wantContent)
+	}
+	if message.AllowedMentions == nil || message.AllowedMentions.Parse == nil || len(message.AllowedMentions.Parse) != 0 {
+		t.Errorf("allowed_mentions = %+v, want an empty parse list so nobody is pinged", message.AllowedMentions)
+	}
+}
+
+func TestDiscordMessageLimit(t *testing.T) {
+	long := testNotification
+	long.Message = strings.Repeat("ä", 3*discordMessageLimit)
+	message := newDiscordMessage(long)
+	if length := len([]rune(message.Content)); length != discordMessageLimit {
+		t.Errorf("message has %d characters, want %d", length, discordMessageLimit)
+	}
+}
+
+func TestGenericWebhook(t *testing.T) {
+	url, body := webhookServer(t, http.StatusOK)
+	webhook := webhookNotifier{url: url, client: http.DefaultClient}
+	err := webhook.Notify(context.Background(), testNotification)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var received notification
+	err = json.Unmarshal(body(), &received)
+	if err != nil {
+		t.Fatalf("invalid webhook payload: %v", err)
+	}
+	if received.Event != eventWanted || received.DisplayName != testNotification.DisplayName ||
+		received.PlayfabId != testNotification.PlayfabId || !received.Time.Equal(testNotification.Time) {
+		t.Errorf("webhook received %+v, want %+v", received, testNotification)
+	}
+}
+
+func TestWebhookError(t *testing.T) {
+	url, _ := webhookServer(t, http.StatusTooManyRequests)
+	webhook := webhookNotifier{url: url, client: http.DefaultClient}
+	err := webhook.Notify(context.Background(), testNotification)
+	if err == nil || !strings.Contains(err.Error(), "429") {
+		t.Errorf("error = %v, want the response status", err)
+	}
+}
+
+func TestNotifyRoutes(t *testing.T) {
+	tests := []struct {
+		name           string
+		routes         string
+		discordWebhook string
+		webhookUrl     string
+		// err is part of the expected error, empty if the routes are valid
+		err string
+	}{
+		{"valid", "wanted_player=bell,desktop;ban=discord; suspicious_player = webhook ", "https://discord", "https://hook", ""},
+		{"disabled event", "wanted_player=", "", "", ""},
+		{"empty", "", "", "", ""},
+		{"missing notifiers", "ban", "", "", "expected event=notifiers"},
+		{"unknown event", "kick=bell", "", "", `unknown notification event "kick"`},
+		{"unknown notifier", "ban=pager", "", "", `unknown notifier "pager"`},
+		{"discord without url", "ban=discord", "", "", "requires a discord webhook URL"},
+		{"webhook without url", "ban=webhook", "https://discord", "", "requires a webhook URL"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			routes, err := parseNotifyRoutes(test.routes)
+			if err == nil {
+				cfg := config{Notify: routes, DiscordWebhook: test.discordWebhook, WebhookUrl: test.webhookUrl}
+				err = checkNotifyRoutes(cfg)
+			}
+			switch {
+			case test.err == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+				t.Errorf("error = %v, want it to contain %q", err, test.err)
+			}
+		})
+	}
+
+	routes, _ := parseNotifyRoutes("wanted_player=;ban=bell, discord")
+	if names, ok := routes[eventWanted]; !ok || len(names) != 0 {
+		t.Errorf("wanted_player routes = %q, want an empty list", names)
+	}
+	if names := routes[eventBan]; len(names) != 2 || names[1] != "discord" {
+		t.Errorf("ban routes = %q, want bell and discord", names)
+	}
+}
+
+// queueNotifier hands every notification it receives to the test
+type queueNotifier chan notification
+
+func (n queueNotifier) Notify(ctx context.Context, notification notification) error {
+	n <- notification
+	return nil
+}
+
+func TestNotificationInterval(t *testing.T) {
+	received := make(queueNotifier, 10)
+	router := &notificationRouter{
+		timeout:   time.Second,
+		interval:  100 * time.Millisecond,
+		routes:    map[string][]string{eventWanted: {"webhook"}, eventBan: {"webhook"}},
+		notifiers: map[string]Notifier{"webhook": received},
+	}
+	players := []string{"AAAA000000000001", "AAAA000000000002", "AAAA000000000003", "AAAA000000000004", "AAAA000000000005"}
+	for _, playfabId := range players {
+		router.notify(notification{Event: eventWanted, Title: "Wanted player", Message: playfabId, PlayfabId: playfabId})
+	}
+
+	first := <-received
+	if first.Event != eventWanted || first.PlayfabId != players[0] {
+		t.Errorf("first notification = %+v, want the first player right away", first)
+	}
+	select {
+	case n := <-received:
+		t.Fatalf("received %+v before the interval passed", n)
+	case <-time.After(50 * time.Millisecond):
+	}
+	var batch notification
+	select {
+	case batch = <-received:
+	case <-time.After(time.Second):
+		t.Fatal("the queued notifications were not sent after the interval")
+	}
+	if batch.Event != eventBatch || len(batch.Batch) != len(players)-1 || batch.Batch[0].PlayfabId != players[1] {
+		t.Errorf("batch = %+v, want the other %d players", batch, len(players)-1)
+	}
+	if !strings.Contains(batch.Message, players[4]) {
+		t.Errorf("batch message %q doesn't mention the last player", batch.Message)
+	}
+
+	// wait sends the queue without waiting for the interval
+	router.notify(notification{Event: eventBan, Title: "Ban", PlayfabId: players[0]})
+	router.wait()
+	select {
+	case n := <-received:
+		if n.Event != eventBan {
+			t.Errorf("notification = %+v, want the ban", n)
+		}
+	default:
+		t.Error("wait didn't send the queued ban")
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+// playerNumbers hands out player numbers that stay the same for the whole session,
+// so a number refers to the same player no matter how often the player list is refreshed
+type playerNumbers struct {
+	next int
+	byId map[string]int
+	// players holds the last known record of every numbered player
+	players map[int]validatedPlayer
+}
+
+func newPlayerNumbers() *playerNumbers {
+	return &playerNumbers{
+		next:    1,
+		byId:    make(map[string]int),
+		players: make(map[int]validatedPlayer),
+	}
+}
+
+// assign sets the number of every player, players that are new to the session get the next free numbers
+func (numbers *playerNumbers) assign(validatedPlayers []validatedPlayer) {
+	for i, player := range validatedPlayers {
+		number, ok := numbers.byId[player.PlayfabId]
+		if !ok {
+			number = numbers.next
+			numbers.next++
+			numbers.byId[player.PlayfabId] = number
+		}
+		validatedPlayers[i].Number = number
+		numbers.players[number] = validatedPlayers[i]
+	}
+}
+
+// lookup returns the last known record of the player with the given number
+func (numbers *playerNumbers) lookup(number int) (player validatedPlayer, ok bool) {
+	player, ok = numbers.players[number]
+	return
+}
+
+// byPlayfabId returns the last known record of a numbered player
+func (numbers *playerNumbers) byPlayfabId(playfabId string) (player validatedPlayer, ok bool) {
+	number, ok := numbers.byId[playfabId]
+	if !ok {
+		return
+	}
+	return numbers.lookup(number)
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// validationReport is the result of validating one listplayers dump
+type validationReport struct {
+	Source     string         `json:"source"`
+	ServerName string         `json:"server_name"`
+	Players    []reportPlayer `json:"players"`
+	Error      string         `json:"error,omitempty"`
+}
+
+// reportPlayer is a validated player together with the columns of their listplayers row
+type reportPlayer struct {
+	validatedPlayer
+	PlayerNumber int               `json:"player_number"`
+	CachedAt     *time.Time        `json:"cached_at,omitempty"`
+	Columns      map[string]string `json:"columns"`
+	// columnNames keeps the order of the listplayers columns
+	columnNames []string
+}
+
+// reportRenderer writes validation reports in one output format
+type reportRenderer func(out io.Writer, reports []validationReport) error
+
+// outputFormats lists the formats the validation reports can be printed in
+var outputFormats = []string{"table", "json", "jsonl", "csv", "markdown"}
+
+var reportRenderers = map[string]reportRenderer{
+	"table":    renderTable,
+	"json":     renderJson,
+	"jsonl":    renderJsonLines,
+	"csv":      renderCsv,
+	"markdown": renderMarkdown,
+}
+
+// newValidationReport creates the report of a validated dump
+func newValidationReport(source, serverName string, validatedPlayers []validatedPlayer, err error) (report validationReport) {
+	sortPlayers(validatedPlayers)
+	report = validationReport{
+		Source:     source,
+		ServerName: serverName,
+		Players:    make([]reportPlayer, 0, len(validatedPlayers)),
+	}
+	for i, player := range validatedPlayers {
+		if player.Number == 0 {
+			// Players are only numbered by the app, outside of it the table position is used
+			player.Number = i + 1
+		}
+		reported := reportPlayer{
+			validatedPlayer: player,
+			PlayerNumber:    player.Number,
+			Columns:         make(map[string]string, len(player.Connection.Columns)),
+			columnNames:     make([]string, 0, len(player.Connection.Columns)),
+		}
+		if !player.CachedAt.IsZero() {
+			reported.CachedAt = &player.CachedAt
+		}
+		for _, column := range player.Connection.Columns {
+			reported.Columns[column.Name] = column.Value
+			reported.columnNames = append(reported.columnNames, column.Name)
+		}
+		report.Players = append(report.Players, reported)
+	}
+	if err != nil {
+		report.Error = err.Error()
+	}
+	return
+}
+
+// printReports writes the validation reports in one of the outputFormats
+func printReports(out io.Writer, format string, reports []validationReport) error {
+	render, ok := reportRenderers[format]
+	if !ok {
+		return fmt.Errorf("unknown output format %q", format)
+	}
+	return render(out, reports)
+}
+
+// renderTable prints the human readable table of every report
+func renderTable(out io.Writer, reports []validationReport) error {
+	for _, report := range reports {
+		if report.Error != "" {
+			continue
+		}
+		fmt.Fprintf(out, "%s (%s)\n", report.ServerName, report.Source)
+		validatedPlayers := make([]validatedPlayer, 0, len(report.Players))
+		for _, player := range report.Players {
+			validatedPlayers = append(validatedPlayers, player.validatedPlayer)
+		}
+		printTable(out, validatedPlayers)
+	}
+	return nil
+}
+
+// renderJson writes all reports as a single JSON array
+func renderJson(out io.Writer, reports []validationReport) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(reports)
+}
+
+// renderJsonLines writes one JSON object per player, and one per dump that failed to validate
+func renderJsonLines(out io.Writer, reports []validationReport) error {
+	type line struct {
+		Source     string `json:"source"`
+		ServerName string `json:"server_name"`
+		Error      string `json:"error,omitempty"`
+		*reportPlayer
+	}
+	encoder := json.NewEncoder(out)
+	for _, report := range reports {
+		if report.Error != "" {
+			err := encoder.Encode(line{Source: report.Source, ServerName: report.ServerName, Error: report.Error})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		for i := range report.Players {
+			err := encoder.Encode(line{Source: report.Source, ServerName: report.ServerName, reportPlayer: &report.Players[i]})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// renderCsv writes one row per player. The listplayers columns of all dumps are appended after the player fields.
+// Cells are escaped, so player names can't inject formulas into spreadsheets.
+func renderCsv(out io.Writer, reports []validationReport) error {
+	header := []string{
+		"source", "server_name", "player_number", "playfab_id", "display_name", "aliases", "created_at", "platform",
+		"wanted_level", "wanted_for", "ban_command", "cached_at",
+	}
+	fieldCount := len(header)
+	for _, report := range reports {
+		for _, player := range report.Players {
+			for _, name := range player.columnNames {
+				if !slices.Contains(header[fieldCount:], name) {
+					header = append(header, name)
+				}
+			}
+		}
+	}
+
+	writer := csv.NewWriter(out)
+	err := writer.Write(escapeCsvRow(header))
+	if err != nil {
+		return err
+	}
+	for _, report := range reports {
+		for _, player := range report.Players {
+			createdAt, cachedAt := "", ""
+			if !player.CreatedAt.IsZero() {
+				createdAt = player.CreatedAt.Format(time.RFC3339)
+			}
+			if player.CachedAt != nil {
+				cachedAt = player.CachedAt.Format(time.RFC3339)
+			}
+			row := []string{
+				report.Source, report.ServerName, strconv.Itoa(player.PlayerNumber), player.PlayfabId, player.DisplayName,
+				strings.Join(player.Aliases, "; "), createdAt, player.Platform,
+				player.WantedLevel, strings.Join(player.WantedFor, "; "), player.BanCommand, cachedAt,
+			}
+			for _, name := range header[fieldCount:] {
+				row = append(row, player.Columns[name])
+			}
+			err = writer.Write(escapeCsvRow(row))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// escapeCsvRow prefixes cells that spreadsheets would run as a formula with a quote. Numbers are kept as they are.
+func escapeCsvRow(row []string) (escaped []string) {
+	escaped = make([]string, 0, len(row))
+	for _, cell := range row {
+		_, err := strconv.ParseFloat(cell, 64)
+		if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) && err != nil {
+			cell = "'" + cell
+		}
+		escaped = append(escaped, cell)
+	}
+	return
+}
+
+// renderMarkdown writes a list per dump for pasting into Discord tickets.
+// Discord does not render markdown tables, so every player is a list item. Numbered lists are avoided
+// since markdown renumbers them, which would not match the player numbers.
+func renderMarkdown(out io.Writer, reports []validationReport) error {
+	for _, report := range reports {
+		fmt.Fprintf(out, "**%s** (%s)\n", escapeMarkdown(report.ServerName), escapeMarkdown(report.Source))
+		if report.Error != "" {
+			fmt.Fprintf(out, "Validation failed: %s\n\n", escapeMarkdown(report.Error))
+			continue
+		}
+		for _, player := range report.Players {
+			details := make([]string, 0, 4+len(player.columnNames))
+			if player.Platform != "" {
+				details = append(details, player.Platform)
+			}
+			if !player.CreatedAt.IsZero() {
+				details = append(details, "created "+player.CreatedAt.Format("2006-01-02 15:04"))
+			}
+			if len(player.Aliases) > 0 {
+				details = append(details, "aliases: "+escapeMarkdown(strings.Join(player.Aliases, ", ")))
+			}
+			for _, name := range player.columnNames {
+				if isStatsColumn(name) {
+					details = append(details, escapeMarkdown(name+" "+player.Columns[name]))
+				}
+			}
+			if player.CachedAt != nil {
+				details = append(details, "cached "+formatAge(time.Since(*player.CachedAt))+" ago")
+			}
+			fmt.Fprintf(out, "- %d **%s** `%s` %s\n", player.PlayerNumber, escapeMarkdown(player.DisplayName), player.PlayfabId, strings.Join(details, ", "))
+			indent := "  "
+			if player.WantedLevel != "" {
+				reasons := ""
+				if len(player.WantedFor) > 0 {
+					reasons = " for " + escapeMarkdown(strings.Join(player.WantedFor, ", "))
+				}
+				fmt.Fprintf(out, "%s- **%s**%s\n", indent, strings.ToUpper(player.WantedLevel), reasons)
+			}
+			if player.BanCommand != "" {
+				fmt.Fprintf(out, "%s- `%s`\n", indent, strings.ReplaceAll(player.BanCommand, "`", "'"))
+			}
+		}
+		fmt.Fprintln(out)
+	}
+	return nil
+}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "~", `\~`, "|", `\|`, ">", `\>`, "#", `\#`,
+)
+
+// escapeMarkdown makes player controlled text safe to paste into Discord
+func escapeMarkdown(text string) string {
+	return markdownEscaper.Replace(text)
+}
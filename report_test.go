@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testReports are a validated dump with a player who tries to inject a formula, and a dump that failed to validate
+func testReports() []validationReport {
+	players := []validatedPlayer{
+		{
+			PlayfabId:   "AAAA000000000002",
+			DisplayName: "=HYPERLINK(\"http://x\")",
+			Aliases:     []string{"@Al"},
+			WantedLevel: "wanted",
+			WantedFor:   []string{"cheating"},
+			BanCommand:  "banbyid AAAA000000000002 0 cheating",
+			Connection:  connectedPlayer{Columns: []playerColumn{{"Score", "-5"}, {"Kills", "+3"}}},
+		},
+		{PlayfabId: "AAAA000000000001", DisplayName: "Bob_*", Connection: connectedPlayer{Columns: []playerColumn{{"Score", "10"}}}},
+	}
+	return []validationReport{
+		newValidationReport("dump.txt", "DEFSAK Test", players, nil),
+		newValidationReport("broken.txt", "", nil, errors.New("backend down")),
+	}
+}
+
+func TestRenderReports(t *testing.T) {
+	tests := []struct {
+		format string
+		check  func(t *testing.T, output string)
+	}{
+		{"json", func(t *testing.T, output string) {
+			var reports []validationReport
+			err := json.Unmarshal([]byte(output), &reports)
+			if err != nil {
+				t.Fatalf("invalid JSON: %v", err)
+			}
+			if len(reports) != 2 || len(reports[0].Players) != 2 || reports[1].Error != "backend down" {
+				t.Fatalf("reports = %+v, want both dumps", reports)
+			}
+			if player := reports[0].Players[0]; player.PlayerNumber != 1 || player.Columns["Score"] != "-5" {
+				t.Errorf("first player = %+v, want the wanted player with their columns", player)
+			}
+		}},
+		{"jsonl", func(t *testing.T, output string) {
+			lines := strings.Split(strings.TrimSpace(output), "\n")
+			if len(lines) != 3 {
+				t.Fatalf("got %d lines, want one per player and one for the failed dump", len(lines))
+			}
+			var line struct {
+				Source    string `json:"source"`
+				PlayfabId string `json:"playfab_id"`
+				Error     string `json:"error"`
+			}
+			for i, want := range []string{"AAAA000000000002", "AAAA000000000001", ""} {
+				line.PlayfabId = ""
+				err := json.Unmarshal([]byte(lines[i]), &line)
+				if err != nil || line.PlayfabId != want {
+					t.Errorf("line %d = %s, want player %q", i, lines[i], want)
+				}
+			}
+			if line.Source != "broken.txt" || line.Error != "backend down" {
+				t.Errorf("last line = %s, want the error of the failed dump", lines[2])
+			}
+		}},
+		{"csv", func(t *testing.T, output string) {
+			rows, err := csv.NewReader(strings.NewReader(output)).ReadAll()
+			if err != nil {
+				t.Fatalf("invalid CSV: %v", err)
+			}
+			if len(rows) != 3 {
+				t.Fatalf("got %d rows, want the header and one per player", len(rows))
+			}
+			header := rows[0]
+			if header[len(header)-2] != "Score" || header[len(header)-1] != "Kills" {
+				t.Errorf("header = %q, want the listplayers columns at the end", header)
+			}
+			wanted := rows[1]
+			for i, want := range map[int]string{4: `'=HYPERLINK("http://x")`, 5: "'@Al", 12: "-5", 13: "+3"} {
+				if wanted[i] != want {
+					t.Errorf("%s = %q, want %q", header[i], wanted[i], want)
+				}
+			}
+			if bob := rows[2]; bob[len(bob)-1] != "" {
+				t.Errorf("Bob's kills = %q, want an empty cell", bob[len(bob)-1])
+			}
+		}},
+		{"markdown", func(t *testing.T, output string) {
+			for _, want := range []string{
+				"**DEFSAK Test** (dump.txt)",
+				"- 2 **Bob\\_\\*** `AAAA000000000001`",
+				"  - **WANTED** for cheating",
+				"  - `banbyid AAAA000000000002 0 cheating`",
+				"Validation failed: backend down",
+			} {
+				if !strings.Contains(output, want) {
+					t.Errorf("output doesn't contain %q:\n%s", want, output)
+				}
+			}
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			var out bytes.Buffer
+			err := printReports(&out, test.format, testReports())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			test.check(t, out.String())
+		})
+	}
+}
+
+func TestEscapeCsvRow(t *testing.T) {
+	row := []string{"=1+1", "+1", "-1", "-", "@SUM(A1)", "\tx", "Bob", "", "1e3"}
+	want := []string{"'=1+1", "+1", "-1", "'-", "'@SUM(A1)", "'\tx", "Bob", "", "1e3"}
+	escaped := escapeCsvRow(row)
+	for i := range want {
+		if escaped[i] != want[i] {
+			t.Errorf("cell %q = %q, want %q", row[i], escaped[i], want[i])
+		}
+	}
+	if row[0] != "=1+1" {
+		t.Error("the row was changed in place")
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"github.com/charmbracelet/log"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	minBackoff = 500 * time.Millisecond
+	maxBackoff = 10 * time.Second
+)
+
+// post sends the body to the endpoint. Network errors, timeouts, rate limiting and server errors are retried
+// with exponential backoff until svc.maxRetries is reached. Every attempt has its own deadline of svc.timeout.
+func (svc backendService) post(ctx context.Context, client *http.Client, url string, body []byte) (resp *http.Response, err error) {
+	return svc.send(ctx, client, url, body, true)
+}
+
+// postAction sends a request that must not be applied twice, like a ban. After a timeout or a server error
+// the backend might have applied it already, so it's only retried when it was rate limited, the backend
+// was unavailable or the request could not be sent at all.
+func (svc backendService) postAction(ctx context.Context, client *http.Client, url string, body []byte) (resp *http.Response, err error) {
+	return svc.send(ctx, client, url, body, false)
+}
+
+// send posts the body and retries failed attempts, idempotent requests are retried after any failure
+func (svc backendService) send(ctx context.Context, client *http.Client, url string, body []byte, idempotent bool) (resp *http.Response, err error) {
+	for attempt := 0; ; attempt++ {
+		callCtx, cancel := context.WithTimeout(ctx, svc.timeout)
+		// sent tells whether the backend might have received the request
+		var sent atomic.Bool
+		trace := &httptrace.ClientTrace{WroteRequest: func(httptrace.WroteRequestInfo) { sent.Store(true) }}
+		req, _ := http.NewRequestWithContext(httptrace.WithClientTrace(callCtx, trace), http.MethodPost, url, bytes.NewReader(body))
+		resp, err = client.Do(req)
+		var retryable bool
+		switch {
+		case idempotent:
+			retryable = err != nil || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		case err != nil:
+			retryable = !sent.Load()
+		default:
+			retryable = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable
+		}
+		if !retryable || attempt >= svc.maxRetries || ctx.Err() != nil {
+			if err != nil {
+				cancel()
+				return
+			}
+			// The deadline also covers reading the response
+			resp.Body = cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+			return
+		}
+
+		delay := backoff(attempt)
+		var reason []any
+		if err != nil {
+			reason = []any{"err", err}
+		} else {
+			reason = []any{"status", resp.Status}
+			if retryAfter, parseErr := strconv.Atoi(resp.Header.Get("Retry-After")); parseErr == nil {
+				delay = min(time.Duration(retryAfter)*time.Second, maxBackoff)
+			}
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+		cancel()
+		log.Warn("Backend call failed, retrying", append([]any{"attempt", attempt + 1, "delay", delay.Round(time.Millisecond)}, reason...)...)
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		}
+	}
+}
+
+// backoff returns the delay before the next attempt, which doubles every attempt up to maxBackoff.
+// Half of the delay is random so that clients don't retry in lockstep.
+func backoff(attempt int) time.Duration {
+	delay := min(minBackoff<<attempt, maxBackoff)
+	return delay/2 + rand.N(delay/2+1)
+}
+
+// cancelOnClose releases the context of a request once its response is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
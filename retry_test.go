@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// failingServer lets handle answer every attempt, it responds with an empty JSON object when handle returns false.
+// It counts the attempts it received.
+func failingServer(t *testing.T, attempts *atomic.Int32, handle func(w http.ResponseWriter, r *http.Request, attempt int) bool) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempt := int(attempts.Add(1)) - 1
+		// Reading the body lets the server notice when the client gives up
+		_, _ = io.Copy(io.Discard, r.Body)
+		if !handle(w, r, attempt) {
+			_, _ = w.Write([]byte("{}"))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestPostRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxRetries int
+		// statuses are the responses to the first attempts, later attempts succeed
+		statuses     []int
+		retryAfter   string
+		wantStatus   int
+		wantAttempts int32
+		// minDuration is how long the retries must take at least
+		minDuration time.Duration
+	}{
+		{"success", 3, nil, "", http.StatusOK, 1, 0},
+		{"server error is retried", 3, []int{http.StatusInternalServerError, http.StatusBadGateway}, "", http.StatusOK, 3, minBackoff / 2},
+		{"server error until max retries", 2, []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable}, "", http.StatusServiceUnavailable, 3, minBackoff},
+		{"client error is not retried", 3, []int{http.StatusBadRequest}, "", http.StatusBadRequest, 1, 0},
+		{"permission denied is not retried", 3, []int{http.StatusForbidden}, "", http.StatusForbidden, 1, 0},
+		{"rate limit honours retry-after", 3, []int{http.StatusTooManyRequests}, "1", http.StatusOK, 2, time.Second},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			url := failingServer(t, &attempts, func(w http.ResponseWriter, r *http.Request, attempt int) bool {
+				if attempt >= len(test.statuses) {
+					return false
+				}
+				if test.retryAfter != "" {
+					w.Header().Set("Retry-After", test.retryAfter)
+				}
+				w.WriteHeader(test.statuses[attempt])
+				return true
+			})
+			svc := backendService{timeout: time.Second, maxRetries: test.maxRetries}
+
+			start := time.Now()
+			resp, err := svc.post(context.Background(), http.DefaultClient, url, []byte("{}"))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			_ = resp.Body.Close()
+			if resp.StatusCode != test.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, test.wantStatus)
+			}
+			if attempts.Load() != test.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts.Load(), test.wantAttempts)
+			}
+			if elapsed := time.Since(start); elapsed < test.minDuration {
+				t.Errorf("took %v, want at least %v", elapsed, test.minDuration)
+			}
+		})
+	}
+}
+
+func TestPostAttemptTimeout(t *testing.T) {
+	var attempts atomic.Int32
+	url := failingServer(t, &attempts, func(w http.ResponseWriter, r *http.Request, attempt int) bool {
+		if attempt == 0 {
+			// The first attempt hangs until the client gives up
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+			return true
+		}
+		return false
+	})
+
+	svc := backendService{timeout: 50 * time.Millisecond, maxRetries: 0}
+	_, err := svc.post(context.Background(), http.DefaultClient, url, []byte("{}"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("error = %v, want the attempt deadline to be exceeded", err)
+	}
+
+	// With a retry, the next attempt gets a new deadline
+	attempts.Store(0)
+	svc.maxRetries = 1
+	resp, err := svc.post(context.Background(), http.DefaultClient, url, []byte("{}"))
+	if err != nil {
+		t.Fatalf("unexpected error after retry: %v", err)
+	}
+	_ = resp.Body.Close()
+	if attempts.Load() != 2 {
+		t.Errorf("attempts = %d, want 2", attempts.Load())
+	}
+}
+
+func TestPostCancelDuringBackoff(t *testing.T) {
+	var attempts atomic.Int32
+	url := failingServer(t, &attempts, func(w http.ResponseWriter, r *http.Request, attempt int) bool {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return true
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	svc := backendService{timeout: time.Second, maxRetries: 5}
+	start := time.Now()
+	_, err := svc.post(ctx, http.DefaultClient, url, []byte("{}"))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("error = %v, want %v", err, context.Canceled)
+	}
+	// The first backoff is at least minBackoff/2, cancelling must not wait for it
+	if elapsed := time.Since(start); elapsed >= minBackoff/2 {
+		t.Errorf("took %v, want the backoff to be cut short", elapsed)
+	}
+	if attempts.Load() != 1 {
+		t.Errorf("attempts = %d, want 1", attempts.Load())
+	}
+}
+
+func TestPostActionRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantStatus   int
+		wantAttempts int32
+	}{
+		{"success", nil, http.StatusOK, 1},
+		{"rate limit is retried", []int{http.StatusTooManyRequests}, http.StatusOK, 2},
+		{"unavailable is retried", []int{http.StatusServiceUnavailable}, http.StatusOK, 2},
+		{"server error is not retried", []int{http.StatusInternalServerError}, http.StatusInternalServerError, 1},
+		{"bad gateway is not retried", []int{http.StatusBadGateway}, http.StatusBadGateway, 1},
+		{"client error is not retried", []int{http.StatusBadRequest}, http.StatusBadRequest, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			url := failingServer(t, &attempts, func(w http.ResponseWriter, r *http.Request, attempt int) bool {
+				if attempt >= len(test.statuses) {
+					return false
+				}
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(test.statuses[attempt])
+				return true
+			})
+			svc := backendService{timeout: time.Second, maxRetries: 3}
+			resp, err := svc.postAction(context.Background(), http.DefaultClient, url, []byte("{}"))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			_ = resp.Body.Close()
+			if resp.StatusCode != test.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, test.wantStatus)
+			}
+			if attempts.Load() != test.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts.Load(), test.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestPostActionTimeoutIsNotRetried(t *testing.T) {
+	var attempts atomic.Int32
+	url := failingServer(t, &attempts, func(w http.ResponseWriter, r *http.Request, attempt int) bool {
+		// The backend might still apply the action after the client gave up
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+		return true
+	})
+	svc := backendService{timeout: 50 * time.Millisecond, maxRetries: 3}
+	_, err := svc.postAction(context.Background(), http.DefaultClient, url, []byte("{}"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("error = %v, want the attempt deadline to be exceeded", err)
+	}
+	if attempts.Load() != 1 {
+		t.Errorf("attempts = %d, want 1", attempts.Load())
+	}
+}
+
+// unreachableTransport fails every request before it is sent
+type unreachableTransport struct {
+	attempts atomic.Int32
+}
+
+func (transport *unreachableTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport.attempts.Add(1)
+	return nil, errors.New("connection refused")
+}
+
+func TestPostActionConnectionErrorIsRetried(t *testing.T) {
+	transport := &unreachableTransport{}
+	svc := backendService{timeout: time.Second, maxRetries: 1}
+	_, err := svc.postAction(context.Background(), &http.Client{Transport: transport}, "http://backend.invalid", []byte("{}"))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if transport.attempts.Load() != 2 {
+		t.Errorf("attempts = %d, want 2", transport.attempts.Load())
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/charmbracelet/log"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// serverSession is the state of a single server: its player table, player numbers and scan history.
+// Commands operate on the current session, which is the server of the latest scan unless the admin switched with use.
+type serverSession struct {
+	name string
+	// players is the table that was printed last, which commands refer to
+	players []validatedPlayer
+	numbers *playerNumbers
+	// lastScan is the latest player list of the server, diff compares the table with the scan before, diffBase
+	lastScan playerScan
+	diffBase playerScan
+	diff     scanDiff
+}
+
+func newServerSession(name string) *serverSession {
+	return &serverSession{
+		name:    name,
+		players: make([]validatedPlayer, 0),
+		numbers: newPlayerNumbers(),
+	}
+}
+
+// hasDiff reports whether the table can be compared with a previous scan of the server
+func (session *serverSession) hasDiff() bool {
+	return !session.diffBase.scannedAt.IsZero()
+}
+
+// completionState is a copy of the session state that commands are completed with while they are typed
+type completionState struct {
+	players []validatedPlayer
+	servers []string
+}
+
+// sessionFor returns the session of a server, servers that weren't scanned before get a new session
+func (app *App) sessionFor(serverName string) *serverSession {
+	for _, session := range app.sessions {
+		if session.name == serverName {
+			return session
+		}
+	}
+	session := newServerSession(serverName)
+	app.sessions = append(app.sessions, session)
+	return session
+}
+
+// switchSession makes commands operate on another server.
+// An action waiting for confirmation is kept, since its target was resolved before the server changed.
+func (app *App) switchSession(session *serverSession) {
+	if session == app.session {
+		return
+	}
+	// The app starts with an empty session, leaving it is not worth mentioning
+	if app.session.name != "" {
+		log.Info("Commands now refer to the players of another server", "server", session.name)
+	}
+	app.session = session
+	if app.showServer != nil {
+		app.showServer(session.name)
+	}
+	app.updateCompletion()
+}
+
+// findSession returns the session that a use argument refers to: the number in the servers list,
+// the server name or a unique part of it, ignoring case
+func (app *App) findSession(query string) (session *serverSession, err error) {
+	number, err := strconv.Atoi(query)
+	if err == nil {
+		if number < 1 || number > len(app.sessions) {
+			return nil, errors.New("invalid server number, type servers to list all servers")
+		}
+		return app.sessions[number-1], nil
+	}
+	query = strings.ToLower(query)
+	var matches []*serverSession
+	for _, session := range app.sessions {
+		name := strings.ToLower(session.name)
+		if name == query {
+			return session, nil
+		}
+		if strings.Contains(name, query) {
+			matches = append(matches, session)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no server matches %q, type servers to list all servers", query)
+	case 1:
+		return matches[0], nil
+	}
+	return nil, fmt.Errorf("%d servers match %q, use the server number instead", len(matches), query)
+}
+
+// findPlayer returns the last known record of a player, preferring the current server
+func (app *App) findPlayer(playfabId string) (player validatedPlayer, ok bool) {
+	player, ok = app.session.numbers.byPlayfabId(playfabId)
+	if ok {
+		return
+	}
+	for _, session := range app.sessions {
+		player, ok = session.numbers.byPlayfabId(playfabId)
+		if ok {
+			return
+		}
+	}
+	return
+}
+
+// updateCompletion publishes the state that is needed to complete commands while they are typed
+func (app *App) updateCompletion() {
+	state := completionState{players: slices.Clone(app.session.players)}
+	for _, session := range app.sessions {
+		state.servers = append(state.servers, session.name)
+	}
+	app.completion.Store(&state)
+}
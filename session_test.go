@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFindSession(t *testing.T) {
+	app := newApp(nil, nil, nil, nil, io.Discard, appOptions{})
+	for _, name := range []string{"DEFSAK EU 1", "DEFSAK EU 2", "DEFSAK US"} {
+		app.sessionFor(name)
+	}
+	tests := []struct {
+		name  string
+		query string
+		want  string
+		// err is part of the expected error, empty if a server is found
+		err string
+	}{
+		{"number", "2", "DEFSAK EU 2", ""},
+		{"full name", "defsak eu 1", "DEFSAK EU 1", ""},
+		{"unique part", "us", "DEFSAK US", ""},
+		{"ambiguous part", "eu", "", "2 servers match"},
+		{"no match", "asia", "", "no server matches"},
+		{"number out of range", "4", "", "invalid server number"},
+		{"zero", "0", "", "invalid server number"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			session, err := app.findSession(test.query)
+			switch {
+			case test.err == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)):
+				t.Fatalf("error = %v, want it to contain %q", err, test.err)
+			case test.err == "" && session.name != test.want:
+				t.Errorf("session = %q, want %q", session.name, test.want)
+			}
+		})
+	}
+}
+
+// TestUseCommand makes sure that player numbers refer to the server that was selected with use
+func TestUseCommand(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	clipboardEvents, commandEvents := newFakeEvents(), newFakeEvents()
+	clipboard := &fakeClipboard{}
+	out := &syncBuffer{}
+	app := newApp(newTestService(t, newTestBackend()), clipboardEvents, commandEvents, clipboard, out, appOptions{confirm: confirmNever})
+	done := make(chan struct{})
+	go func() {
+		app.Run(context.Background())
+		close(done)
+	}()
+
+	clipboardEvents.Send(testDump)
+	waitFor(t, "the first player table", func() bool { return strings.Contains(out.String(), "Alice") })
+	clipboardEvents.Send("ServerName - DEFSAK EU 1\n" +
+		"Name - PlayFabID - EOSID - Score - Kills - Deaths\n" +
+		"Carl - AAAA000000000003 - eos3 - 0 - 0 - 0\n")
+	waitFor(t, "the second player table", func() bool { return strings.Contains(out.String(), "Carl") })
+	for _, command := range []string{"kick 1", "use Test", "kick 1", "use 2", "use nothing", "kick 1"} {
+		commandEvents.Send(command)
+	}
+	commandEvents.Close()
+	<-done
+
+	want := []string{"kickbyid AAAA000000000003", "kickbyid AAAA000000000002", "kickbyid AAAA000000000003"}
+	if writes := clipboard.Writes(); !slices.Equal(writes, want) {
+		t.Errorf("clipboard writes = %q, want %q", writes, want)
+	}
+}
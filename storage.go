@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// stateDirName is the directory in the config dir that holds every file this tool saves.
+// The config dir itself only holds the config file and the credentials, so nothing else can be mistaken for credentials.
+const stateDirName = "state"
+
+// legacyStateFiles were saved next to the credentials by earlier versions
+var legacyStateFiles = []string{cacheFileName, wantedBoardFileName, trustFileName, chargesFileName, historyFileName}
+
+// stateDir returns the directory that the files of loadJson and saveJson are kept in
+func stateDir() (dir string, err error) {
+	confDir, err := configDir()
+	if err != nil {
+		return
+	}
+	dir = filepath.Join(confDir, stateDirName)
+	return
+}
+
+// migrateState moves the files that earlier versions saved next to the credentials into the state dir
+func migrateState() (err error) {
+	confDir, err := configDir()
+	if err != nil {
+		return
+	}
+	dir, err := stateDir()
+	if err != nil {
+		return
+	}
+	for _, name := range legacyStateFiles {
+		legacyPath := filepath.Join(confDir, name)
+		_, statErr := os.Stat(legacyPath)
+		if errors.Is(statErr, os.ErrNotExist) {
+			continue
+		}
+		err = os.MkdirAll(dir, 0700)
+		if err != nil {
+			return fmt.Errorf("could not create state dir: %w", err)
+		}
+		err = os.Rename(legacyPath, filepath.Join(dir, name))
+		if err != nil {
+			return fmt.Errorf("could not move %s to the state dir: %w", name, err)
+		}
+	}
+	return
+}
+
+// loadJson decodes a file from the state dir into data. A missing file leaves data untouched.
+func loadJson(name string, data any) (err error) {
+	dir, err := stateDir()
+	if err != nil {
+		return
+	}
+	raw, err := os.ReadFile(filepath.Join(dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("could not read %s: %w", name, err)
+	}
+	err = json.Unmarshal(raw, data)
+	if err != nil {
+		return fmt.Errorf("could not parse %s: %w", name, err)
+	}
+	return
+}
+
+// saveJson writes data to a file in the state dir. The file is replaced atomically,
+// so a crash while saving can't leave a half written file behind.
+func saveJson(name string, data any) (err error) {
+	dir, err := stateDir()
+	if err != nil {
+		return
+	}
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return fmt.Errorf("could not create state dir: %w", err)
+	}
+	raw, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode %s: %w", name, err)
+	}
+	tempFile, err := os.CreateTemp(dir, name+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("could not save %s: %w", name, err)
+	}
+	defer os.Remove(tempFile.Name())
+	_, err = tempFile.Write(raw)
+	closeErr := tempFile.Close()
+	if err != nil || closeErr != nil {
+		return fmt.Errorf("could not save %s: %w", name, errors.Join(err, closeErr))
+	}
+	err = os.Rename(tempFile.Name(), filepath.Join(dir, name))
+	if err != nil {
+		return fmt.Errorf("could not save %s: %w", name, err)
+	}
+	return
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestCredentialsNextToLegacyState makes sure that files of earlier versions are moved out of the way,
+// so they can't be mistaken for credentials
+func TestCredentialsNextToLegacyState(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	confDir, err := configDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.MkdirAll(confDir, 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// ban_charges.json and config.json sort before the credentials
+	for _, name := range []string{chargesFileName, configFileName, trustFileName, "sak-credentials.json"} {
+		err = os.WriteFile(filepath.Join(confDir, name), []byte("{}"), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = migrateState()
+	if err != nil {
+		t.Fatalf("migration failed: %v", err)
+	}
+	for _, name := range []string{chargesFileName, trustFileName} {
+		_, err = os.Stat(filepath.Join(confDir, stateDirName, name))
+		if err != nil {
+			t.Errorf("%s was not moved to the state dir: %v", name, err)
+		}
+	}
+	credentialPath, err := setupCredentials()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if filepath.Base(credentialPath) != "sak-credentials.json" {
+		t.Errorf("credentials = %s, want sak-credentials.json", credentialPath)
+	}
+}
+
+func TestSaveJson(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	err := saveJson(trustFileName, map[string]int{"a": 1})
+	if err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	var loaded map[string]int
+	err = loadJson(trustFileName, &loaded)
+	if err != nil || loaded["a"] != 1 {
+		t.Errorf("loaded %v with error %v, want the saved data", loaded, err)
+	}
+	confDir, _ := configDir()
+	_, err = os.Stat(filepath.Join(confDir, trustFileName))
+	if err == nil {
+		t.Errorf("%s was saved next to the credentials", trustFileName)
+	}
+}
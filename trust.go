@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const trustFileName = "trust.json"
+
+// trustEntry is a player that was trusted from this client
+type trustEntry struct {
+	PlayfabId   string     `json:"playfab_id"`
+	DisplayName string     `json:"display_name"`
+	TrustedAt   time.Time  `json:"trusted_at"`
+	TrustedBy   string     `json:"trusted_by"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	// Confirmed is set once the backend stopped reporting the player as suspicious
+	Confirmed bool `json:"confirmed"`
+}
+
+// expired reports whether the trust has run out
+func (entry trustEntry) expired(now time.Time) bool {
+	return entry.ExpiresAt != nil && now.After(*entry.ExpiresAt)
+}
+
+// trustList remembers trusted players across restarts. Trust takes a while to propagate through the backend,
+// so the local list hides the suspicious marker of these players in the meantime.
+type trustList struct {
+	// persist is false for lists that only live in memory
+	persist bool
+	admin   string
+	entries map[string]trustEntry
+}
+
+// loadTrustList reads the trust list from the config dir. New entries are attributed to admin.
+func loadTrustList(admin string) (trust *trustList, err error) {
+	trust = newTrustList(admin)
+	trust.persist = true
+	err = loadJson(trustFileName, &trust.entries)
+	if err != nil || trust.entries == nil {
+		trust.entries = make(map[string]trustEntry)
+	}
+	return
+}
+
+// newTrustList creates a trust list that is not saved to disk
+func newTrustList(admin string) *trustList {
+	return &trustList{
+		admin:   admin,
+		entries: make(map[string]trustEntry),
+	}
+}
+
+func (trust *trustList) save() error {
+	if !trust.persist {
+		return nil
+	}
+	return saveJson(trustFileName, trust.entries)
+}
+
+// add trusts a player. A zero duration never expires.
+func (trust *trustList) add(playfabId, displayName string, duration time.Duration) error {
+	entry := trustEntry{
+		PlayfabId:   playfabId,
+		DisplayName: displayName,
+		TrustedAt:   time.Now(),
+		TrustedBy:   trust.admin,
+	}
+	if duration > 0 {
+		expiresAt := entry.TrustedAt.Add(duration)
+		entry.ExpiresAt = &expiresAt
+	}
+	trust.entries[playfabId] = entry
+	return trust.save()
+}
+
+// remove deletes a player from the list and reports whether they were on it
+func (trust *trustList) remove(playfabId string) (removed bool, err error) {
+	_, removed = trust.entries[playfabId]
+	delete(trust.entries, playfabId)
+	return removed, trust.save()
+}
+
+// list returns all entries sorted by the time they were trusted
+func (trust *trustList) list() []trustEntry {
+	entries := make([]trustEntry, 0, len(trust.entries))
+	for _, entry := range trust.entries {
+		entries = append(entries, entry)
+	}
+	slices.SortFunc(entries, func(a, b trustEntry) int {
+		return a.TrustedAt.Compare(b.TrustedAt)
+	})
+	return entries
+}
+
+// removeExpired deletes and returns all entries whose trust ran out
+func (trust *trustList) removeExpired() (expired []trustEntry, err error) {
+	now := time.Now()
+	for playfabId, entry := range trust.entries {
+		if entry.expired(now) {
+			expired = append(expired, entry)
+			delete(trust.entries, playfabId)
+		}
+	}
+	if len(expired) > 0 {
+		err = trust.save()
+	}
+	return
+}
+
+// apply hides the suspicious marker of trusted players
+func (trust *trustList) apply(validatedPlayers []validatedPlayer) {
+	now := time.Now()
+	for i, player := range validatedPlayers {
+		entry, ok := trust.entries[player.PlayfabId]
+		if ok && !entry.expired(now) && player.WantedLevel == "suspicious" {
+			validatedPlayers[i].WantedLevel = ""
+			validatedPlayers[i].BanCommand = ""
+		}
+	}
+}
+
+// reconcile compares the list with fresh validation results. Entries are confirmed once the backend
+// applied the trust, and dropped if the backend reports a confirmed player as suspicious again,
+// which means the trust was revoked elsewhere.
+func (trust *trustList) reconcile(validatedPlayers []validatedPlayer) (revoked []trustEntry, err error) {
+	changed := false
+	for _, player := range validatedPlayers {
+		entry, ok := trust.entries[player.PlayfabId]
+		if !ok {
+			continue
+		}
+		suspicious := player.WantedLevel == "suspicious"
+		if !entry.Confirmed && !suspicious {
+			entry.Confirmed = true
+			trust.entries[player.PlayfabId] = entry
+			changed = true
+		} else if entry.Confirmed && suspicious {
+			revoked = append(revoked, entry)
+			delete(trust.entries, player.PlayfabId)
+			changed = true
+		}
+	}
+	if changed {
+		err = trust.save()
+	}
+	return
+}
+
+// parseTrustDuration reads durations like 12h or 7d. Days are not supported by time.ParseDuration.
+func parseTrustDuration(text string) (time.Duration, error) {
+	days, ok := strings.CutSuffix(text, "d")
+	if ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid duration %q", text)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	duration, err := time.ParseDuration(text)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", text)
+	}
+	return duration, nil
+}
@@ -0,0 +1,611 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	tuiDetailHeight = 6
+	tuiLogHeight    = 5
+	// tuiLogLimit is the number of log lines that can be scrolled back to
+	tuiLogLimit = 1000
+)
+
+// runTui runs the app with a full-screen player list instead of printing tables to the console
+func runTui(ctx context.Context, cfg config, flags *flag.FlagSet, args []string) (exitCode int) {
+	exitCode, ok := parseSubcommand(flags, args, 0, 0)
+	if !ok {
+		return
+	}
+
+	commands := make(tuiCommands, 8)
+	model := newTuiModel(commands)
+	program := tea.NewProgram(model, tea.WithAltScreen(), tea.WithContext(ctx))
+	app := setupApp(ctx, cfg, commands, tuiWriter{program}, tuiView{program})
+	model.charges = app.charges
+
+	// Messages can only be sent to the program once it runs, so the app is started by the first command of the program.
+	// Logs would break the screen, so they are shown in the log pane until the TUI is closed.
+	defer log.SetOutput(os.Stderr)
+	appCtx, cancelApp := context.WithCancel(ctx)
+	defer cancelApp()
+	model.start = func() tea.Msg {
+		log.SetOutput(tuiWriter{program})
+		go app.Run(appCtx)
+		log.Info("Chiv admin helper is ready to use, use the listplayers command in game to validate players")
+		return nil
+	}
+
+	_, err := program.Run()
+	if err != nil && !errors.Is(err, tea.ErrProgramKilled) {
+		log.SetOutput(os.Stderr)
+		log.Error("TUI failed", "err", err)
+		return exitError
+	}
+	return exitOk
+}
+
+// tuiCommands passes the console commands of the TUI to the app
+type tuiCommands chan string
+
+func (c tuiCommands) Watch(ctx context.Context) <-chan string {
+	return c
+}
+
+// tuiView sends player tables to the TUI
+type tuiView struct {
+	program *tea.Program
+}
+
+func (v tuiView) ShowPlayers(serverName string, validatedPlayers []validatedPlayer) {
+	v.program.Send(tuiPlayersMsg{serverName, validatedPlayers})
+}
+
+// tuiWriter sends log lines and command output to the log pane of the TUI
+type tuiWriter struct {
+	program *tea.Program
+}
+
+func (w tuiWriter) Write(p []byte) (n int, err error) {
+	w.program.Send(tuiLogMsg(string(p)))
+	return len(p), nil
+}
+
+type tuiPlayersMsg struct {
+	serverName string
+	players    []validatedPlayer
+}
+
+type tuiLogMsg string
+
+// tuiInputMode is what the text typed into the input line is used for
+type tuiInputMode int
+
+const (
+	inputNone tuiInputMode = iota
+	inputFilter
+	inputBan
+	inputTrust
+	inputCommand
+)
+
+// tuiSortMode orders the player list
+type tuiSortMode struct {
+	name    string
+	compare func(a, b validatedPlayer) int
+}
+
+var tuiSortModes = []tuiSortMode{
+	{"name", func(a, b validatedPlayer) int {
+		return strings.Compare(a.DisplayName, b.DisplayName)
+	}},
+	{"wanted", func(a, b validatedPlayer) int {
+		return cmp.Compare(wantedRank(b.WantedLevel), wantedRank(a.WantedLevel))
+	}},
+	{"created", func(a, b validatedPlayer) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	}},
+	{"score", func(a, b validatedPlayer) int {
+		return cmp.Compare(statValue(b.Connection.Score), statValue(a.Connection.Score))
+	}},
+}
+
+// wantedRank sorts wanted players before suspicious ones
+func wantedRank(level string) int {
+	switch level {
+	case "wanted":
+		return 2
+	case "suspicious":
+		return 1
+	}
+	return 0
+}
+
+func statValue(stat *int) int {
+	if stat == nil {
+		return -1
+	}
+	return *stat
+}
+
+var (
+	tuiHeaderStyle   = lipgloss.NewStyle().Bold(true)
+	tuiSelectedStyle = lipgloss.NewStyle().Reverse(true)
+	tuiDetailStyle   = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).Padding(0, 1)
+	tuiFaintStyle    = lipgloss.NewStyle().Faint(true)
+)
+
+// tuiModel is the Bubble Tea model of the player list
+type tuiModel struct {
+	commands   tuiCommands
+	serverName string
+	players    []validatedPlayer
+	// visible holds the indexes of the players after filtering and sorting
+	visible  []int
+	cursor   int
+	offset   int
+	sortMode int
+	filter   string
+
+	inputMode tuiInputMode
+	input     string
+	// target is the player an input refers to
+	target validatedPlayer
+	// charges complete the reasons of a ban
+	charges *chargeCatalogue
+
+	logs []string
+	// showLog shows the log full-screen instead of the player list, so long command output can be read
+	showLog bool
+	// logScroll is the number of lines the log view is scrolled up from the latest line
+	logScroll     int
+	width, height int
+	// start runs once the program is ready to receive messages
+	start tea.Cmd
+}
+
+func newTuiModel(commands tuiCommands) *tuiModel {
+	return &tuiModel{commands: commands}
+}
+
+func (m *tuiModel) Init() tea.Cmd {
+	return m.start
+}
+
+func (m *tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.scroll()
+		m.scrollLog()
+	case tuiPlayersMsg:
+		selected := m.selected()
+		m.serverName = msg.serverName
+		m.players = msg.players
+		m.refresh()
+		// Keep the selection on the same player
+		if selected != nil {
+			for i, index := range m.visible {
+				if m.players[index].PlayfabId == selected.PlayfabId {
+					m.cursor = i
+				}
+			}
+		}
+		m.scroll()
+	case tuiLogMsg:
+		lines := strings.Split(strings.TrimRight(string(msg), "\n"), "\n")
+		m.logs = append(m.logs, lines...)
+		if len(m.logs) > tuiLogLimit {
+			m.logs = m.logs[len(m.logs)-tuiLogLimit:]
+		}
+		if m.logScroll > 0 {
+			// Keep the lines in place that are being read
+			m.logScroll += len(lines)
+			m.scrollLog()
+		}
+	case tea.KeyMsg:
+		if msg.Type == tea.KeyCtrlC {
+			return m, tea.Quit
+		}
+		if m.inputMode != inputNone {
+			return m, m.updateInput(msg)
+		}
+		if m.showLog {
+			return m, m.updateLog(msg)
+		}
+		return m, m.updateList(msg)
+	}
+	return m, nil
+}
+
+// updateList handles keys while no input line is open
+func (m *tuiModel) updateList(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "q":
+		return tea.Quit
+	case "up":
+		m.cursor--
+	case "down":
+		m.cursor++
+	case "pgup":
+		m.cursor -= m.listHeight()
+	case "pgdown":
+		m.cursor += m.listHeight()
+	case "home":
+		m.cursor = 0
+	case "end":
+		m.cursor = len(m.visible) - 1
+	case "s":
+		m.sortMode = (m.sortMode + 1) % len(tuiSortModes)
+		m.refresh()
+	case "/":
+		m.inputMode, m.input = inputFilter, m.filter
+	case ":":
+		m.inputMode, m.input = inputCommand, ""
+	case "esc":
+		m.filter = ""
+		m.refresh()
+	case "k":
+		if player := m.selected(); player != nil {
+			return m.send("kick " + strconv.Itoa(player.Number))
+		}
+	case "b":
+		if player := m.selected(); player != nil {
+			m.inputMode, m.input, m.target = inputBan, "", *player
+		}
+	case "t":
+		if player := m.selected(); player != nil {
+			m.inputMode, m.input, m.target = inputTrust, "", *player
+		}
+	case "y":
+		return m.send("confirm")
+	case "u":
+		return m.send("undo")
+	case "a":
+		return m.send("ack")
+	case "l":
+		m.showLog, m.logScroll = true, 0
+	}
+	m.scroll()
+	return nil
+}
+
+// updateLog handles keys while the log is shown full-screen
+func (m *tuiModel) updateLog(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "q":
+		return tea.Quit
+	case "esc", "l":
+		m.showLog = false
+	case "up":
+		m.logScroll++
+	case "down":
+		m.logScroll--
+	case "pgup":
+		m.logScroll += m.logViewHeight()
+	case "pgdown":
+		m.logScroll -= m.logViewHeight()
+	case "home":
+		m.logScroll = len(m.logs)
+	case "end":
+		m.logScroll = 0
+	case ":":
+		m.inputMode, m.input = inputCommand, ""
+	}
+	m.scrollLog()
+	return nil
+}
+
+// completeCharge completes the last reason of the ban input with the predefined charges
+func (m *tuiModel) completeCharge() {
+	if m.charges == nil {
+		return
+	}
+	start := strings.LastIndex(m.input, " ") + 1
+	matches := m.charges.complete(m.input[start:])
+	if len(matches) == 0 {
+		return
+	}
+	completion := matches[0]
+	for _, match := range matches[1:] {
+		for !strings.HasPrefix(match, completion) {
+			completion = completion[:len(completion)-1]
+		}
+	}
+	if len(matches) == 1 {
+		completion += " "
+	} else {
+		m.logs = append(m.logs, "Charges: "+strings.Join(matches, ", "))
+	}
+	m.input = m.input[:start] + completion
+}
+
+// updateInput handles keys while the input line is open
+func (m *tuiModel) updateInput(msg tea.KeyMsg) tea.Cmd {
+	switch msg.Type {
+	case tea.KeyEsc:
+		if m.inputMode == inputFilter {
+			m.filter = ""
+			m.refresh()
+		}
+		m.inputMode = inputNone
+	case tea.KeyEnter:
+		mode, input := m.inputMode, strings.TrimSpace(m.input)
+		m.inputMode = inputNone
+		switch mode {
+		case inputBan:
+			if input == "" {
+				// Logging here would block, since log lines are sent to this model
+				m.logs = append(m.logs, "Ban requires at least 1 reason")
+				return nil
+			}
+			return m.send(fmt.Sprintf("ban %d %s", m.target.Number, input))
+		case inputTrust:
+			return m.send(strings.TrimSpace(fmt.Sprintf("trust %d %s", m.target.Number, input)))
+		case inputCommand:
+			if input != "" {
+				// The output of the command is shown in the log
+				m.showLog, m.logScroll = true, 0
+				return m.send(input)
+			}
+		}
+	case tea.KeyBackspace:
+		_, size := utf8.DecodeLastRuneInString(m.input)
+		m.input = m.input[:len(m.input)-size]
+	case tea.KeySpace:
+		m.input += " "
+	case tea.KeyTab:
+		if m.inputMode == inputBan {
+			m.completeCharge()
+		}
+	case tea.KeyRunes:
+		m.input += string(msg.Runes)
+	}
+	if m.inputMode == inputFilter {
+		// The filter is applied while typing
+		m.filter = m.input
+		m.refresh()
+		m.scroll()
+	}
+	return nil
+}
+
+// send passes a command to the app. This must not block, since the app might be waiting for the TUI to show a log line.
+func (m *tuiModel) send(command string) tea.Cmd {
+	return func() tea.Msg {
+		m.commands <- command
+		return nil
+	}
+}
+
+// refresh applies the filter and the sort mode
+func (m *tuiModel) refresh() {
+	filter := strings.ToLower(m.filter)
+	m.visible = m.visible[:0]
+	for index, player := range m.players {
+		if filter == "" || matchesFilter(player, filter) {
+			m.visible = append(m.visible, index)
+		}
+	}
+	compare := tuiSortModes[m.sortMode].compare
+	slices.SortStableFunc(m.visible, func(a, b int) int {
+		return cmp.Or(compare(m.players[a], m.players[b]), cmp.Compare(a, b))
+	})
+}
+
+// matchesFilter reports whether the lower case filter is part of the name, aliases, ID or charges of the player
+func matchesFilter(player validatedPlayer, filter string) bool {
+	fields := append([]string{player.DisplayName, player.PlayfabId}, player.Aliases...)
+	fields = append(fields, player.WantedFor...)
+	return slices.ContainsFunc(fields, func(field string) bool {
+		return strings.Contains(strings.ToLower(field), filter)
+	})
+}
+
+// scroll keeps the cursor within the list and the selected row on screen
+func (m *tuiModel) scroll() {
+	m.cursor = max(min(m.cursor, len(m.visible)-1), 0)
+	height := m.listHeight()
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	} else if m.cursor >= m.offset+height {
+		m.offset = m.cursor - height + 1
+	}
+	m.offset = max(min(m.offset, len(m.visible)-height), 0)
+}
+
+// scrollLog keeps the log view within the log lines
+func (m *tuiModel) scrollLog() {
+	m.logScroll = max(min(m.logScroll, len(m.logs)-m.logViewHeight()), 0)
+}
+
+func (m *tuiModel) logViewHeight() int {
+	// Header and input line
+	return max(m.height-2, 1)
+}
+
+func (m *tuiModel) listHeight() int {
+	// Header, detail pane with border, log pane and input line
+	return max(m.height-1-(tuiDetailHeight+2)-tuiLogHeight-1, 3)
+}
+
+// selected returns the player in the selected row
+func (m *tuiModel) selected() *validatedPlayer {
+	if m.cursor >= len(m.visible) {
+		return nil
+	}
+	return &m.players[m.visible[m.cursor]]
+}
+
+func (m *tuiModel) View() string {
+	if m.width == 0 {
+		return ""
+	}
+	if m.showLog {
+		return m.logView()
+	}
+	fit := lipgloss.NewStyle().MaxWidth(m.width)
+	sections := make([]string, 0, 5)
+
+	// Header
+	header := "No players yet, use the listplayers command in game"
+	if m.serverName != "" {
+		header = fmt.Sprintf("%s  %d/%d players  sorted by %s", m.serverName, len(m.visible), len(m.players), tuiSortModes[m.sortMode].name)
+		if m.filter != "" {
+			header += fmt.Sprintf("  filter %q", m.filter)
+		}
+	}
+	sections = append(sections, fit.Render(tuiHeaderStyle.Render(header)))
+
+	// Player list
+	height := m.listHeight()
+	nameWidth := 0
+	for _, player := range m.players {
+		nameWidth = max(nameWidth, utf8.RuneCountInString(player.DisplayName))
+	}
+	rows := make([]string, 0, height)
+	for i := m.offset; i < len(m.visible) && i < m.offset+height; i++ {
+		player := m.players[m.visible[i]]
+		createdAt := "????-??-??"
+		if !player.CreatedAt.IsZero() {
+			createdAt = player.CreatedAt.Format("2006-01-02")
+		}
+		row := fmt.Sprintf("%3d  %-16s  %s  %1s  %-*s  %s",
+			player.Number, player.PlayfabId, createdAt, platforms[player.Platform], nameWidth, player.DisplayName, statsSummary(player.Connection))
+		row = fmt.Sprintf("%-*s", m.width, row)
+		style := styles[player.WantedLevel]
+		if i == m.cursor {
+			style = tuiSelectedStyle
+		}
+		rows = append(rows, fit.Render(style.Render(row)))
+	}
+	for len(rows) < height {
+		rows = append(rows, "")
+	}
+	sections = append(sections, strings.Join(rows, "\n"))
+
+	// Detail pane
+	details := m.details()
+	for len(details) < tuiDetailHeight {
+		details = append(details, "")
+	}
+	for i := range details {
+		details[i] = lipgloss.NewStyle().MaxWidth(max(m.width-4, 1)).Render(details[i])
+	}
+	sections = append(sections, tuiDetailStyle.Width(max(m.width-2, 1)).Render(strings.Join(details[:tuiDetailHeight], "\n")))
+
+	// Log pane
+	logs := m.logs[max(len(m.logs)-tuiLogHeight, 0):]
+	for len(logs) < tuiLogHeight {
+		logs = append([]string{""}, logs...)
+	}
+	for _, line := range logs {
+		sections = append(sections, fit.Render(tuiFaintStyle.Render(line)))
+	}
+
+	// Input line or key help
+	sections = append(sections, m.inputLine("↑/↓ select  k kick  b ban  t trust  y confirm  u undo  a ack  / filter  s sort  l log  : command  q quit"))
+	return strings.Join(sections, "\n")
+}
+
+// logView shows as many log lines as fit on the screen
+func (m *tuiModel) logView() string {
+	fit := lipgloss.NewStyle().MaxWidth(m.width)
+	height := m.logViewHeight()
+	end := len(m.logs) - m.logScroll
+	start := max(end-height, 0)
+	header := fmt.Sprintf("Log  lines %d-%d of %d", min(start+1, end), end, len(m.logs))
+	sections := make([]string, 0, height+2)
+	sections = append(sections, fit.Render(tuiHeaderStyle.Render(header)))
+	for _, line := range m.logs[start:end] {
+		sections = append(sections, fit.Render(line))
+	}
+	for len(sections) < height+1 {
+		sections = append(sections, "")
+	}
+	sections = append(sections, m.inputLine("↑/↓ PgUp/PgDn scroll  Home/End first/last line  : command  l/Esc players  q quit"))
+	return strings.Join(sections, "\n")
+}
+
+// inputLine shows the open input line, or the key help
+func (m *tuiModel) inputLine(help string) string {
+	fit := lipgloss.NewStyle().MaxWidth(m.width)
+	switch m.inputMode {
+	case inputFilter:
+		return fit.Render("Filter: " + m.input + "█")
+	case inputBan:
+		return fit.Render(fmt.Sprintf("Ban %s for (Tab completes charges): %s█", m.target.DisplayName, m.input))
+	case inputTrust:
+		return fit.Render(fmt.Sprintf("Trust %s for (empty for ever): %s█", m.target.DisplayName, m.input))
+	case inputCommand:
+		return fit.Render(":" + m.input + "█")
+	default:
+		return fit.Render(tuiFaintStyle.Render(help))
+	}
+}
+
+// details describes the selected player
+func (m *tuiModel) details() []string {
+	player := m.selected()
+	if player == nil {
+		return nil
+	}
+	createdAt := "unknown"
+	if !player.CreatedAt.IsZero() {
+		createdAt = player.CreatedAt.Format("2006-01-02 15:04")
+	}
+	platform := player.Platform
+	if platform == "" {
+		platform = "unknown"
+	}
+	details := []string{
+		fmt.Sprintf("%s  %s  created %s  platform %s", player.DisplayName, player.PlayfabId, createdAt, platform),
+		"Aliases: " + strings.Join(player.Aliases, ", "),
+	}
+	if player.WantedLevel != "" {
+		status := strings.ToUpper(player.WantedLevel)
+		if len(player.WantedFor) > 0 {
+			status += " for " + strings.Join(player.WantedFor, ", ")
+		}
+		details = append(details, styles[player.WantedLevel].Render(status))
+	}
+	if player.BanCommand != "" {
+		details = append(details, player.BanCommand)
+	}
+	columns := make([]string, 0, len(player.Connection.Columns))
+	for _, column := range player.Connection.Columns {
+		columns = append(columns, column.Name+" "+column.Value)
+	}
+	details = append(details, strings.Join(columns, "  "))
+	if !player.CachedAt.IsZero() {
+		details = append(details, "Cached "+formatAge(time.Since(player.CachedAt))+" ago")
+	}
+	return details
+}
+
+// statsSummary shows the score, kills and deaths of a listplayers row
+func statsSummary(player connectedPlayer) string {
+	stats := make([]string, 0, 3)
+	for _, stat := range []struct {
+		name  string
+		value *int
+	}{{"S", player.Score}, {"K", player.Kills}, {"D", player.Deaths}} {
+		if stat.value != nil {
+			stats = append(stats, fmt.Sprintf("%s %4d", stat.name, *stat.value))
+		}
+	}
+	return strings.Join(stats, "  ")
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	tea "github.com/charmbracelet/bubbletea"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestTuiStart makes sure that the app can log and show players as soon as the program starts
+func TestTuiStart(t *testing.T) {
+	model := newTuiModel(make(tuiCommands, 1))
+	var out bytes.Buffer
+	program := tea.NewProgram(model, tea.WithInput(nil), tea.WithOutput(&out), tea.WithoutSignalHandler())
+	started := make(chan struct{})
+	model.start = func() tea.Msg {
+		_, _ = tuiWriter{program}.Write([]byte("ready\n"))
+		tuiView{program}.ShowPlayers("Test Server", []validatedPlayer{{PlayfabId: "AAAA000000000001", DisplayName: "Alice"}})
+		close(started)
+		return nil
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := program.Run()
+		done <- err
+	}()
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		program.Kill()
+		t.Fatal("TUI did not start")
+	}
+	program.Quit()
+	err := <-done
+	if err != nil {
+		t.Fatalf("TUI failed: %v", err)
+	}
+
+	if !slices.Contains(model.logs, "ready") {
+		t.Errorf("log pane = %q, want it to contain %q", model.logs, "ready")
+	}
+	if model.serverName != "Test Server" || len(model.players) != 1 {
+		t.Errorf("TUI shows %d players of %q, want 1 player of %q", len(model.players), model.serverName, "Test Server")
+	}
+}
+
+func TestTuiLogView(t *testing.T) {
+	commands := make(tuiCommands, 1)
+	model := newTuiModel(commands)
+	model.Update(tea.WindowSizeMsg{Width: 80, Height: 12})
+	for i := 1; i <= 30; i++ {
+		model.Update(tuiLogMsg(fmt.Sprintf("line %d\n", i)))
+	}
+	key := func(keys ...tea.KeyMsg) {
+		for _, msg := range keys {
+			_, cmd := model.Update(msg)
+			if cmd != nil {
+				cmd()
+			}
+		}
+	}
+	runes := func(text string) tea.KeyMsg {
+		return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(text)}
+	}
+
+	tests := []struct {
+		name string
+		keys []tea.KeyMsg
+		// first and last are the first and last log lines on screen
+		first, last int
+	}{
+		{"open", []tea.KeyMsg{runes("l")}, 21, 30},
+		{"page up", []tea.KeyMsg{{Type: tea.KeyPgUp}}, 11, 20},
+		{"up", []tea.KeyMsg{{Type: tea.KeyUp}}, 10, 19},
+		{"first line", []tea.KeyMsg{{Type: tea.KeyHome}, {Type: tea.KeyUp}}, 1, 10},
+		{"last line", []tea.KeyMsg{{Type: tea.KeyEnd}, {Type: tea.KeyDown}}, 21, 30},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			key(test.keys...)
+			view := model.View()
+			want := fmt.Sprintf("Log  lines %d-%d of 30", test.first, test.last)
+			if !strings.Contains(view, want) || !strings.Contains(view, fmt.Sprintf("line %d\n", test.last)) {
+				t.Errorf("view doesn't show %q:\n%s", want, view)
+			}
+		})
+	}
+
+	// New lines don't move the lines that are being read
+	key(tea.KeyMsg{Type: tea.KeyPgUp})
+	model.Update(tuiLogMsg("line 31\n"))
+	if view := model.View(); !strings.Contains(view, "Log  lines 11-20 of 31") {
+		t.Errorf("view moved after a new line:\n%s", view)
+	}
+
+	// Commands show their output in the log
+	key(tea.KeyMsg{Type: tea.KeyEsc})
+	if model.showLog {
+		t.Fatal("Esc didn't close the log")
+	}
+	key(runes(":"), runes("help"), tea.KeyMsg{Type: tea.KeyEnter})
+	if command := <-commands; command != "help" || !model.showLog || model.logScroll != 0 {
+		t.Errorf("command %q with log shown %v at %d, want help with the latest log lines", command, model.showLog, model.logScroll)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"github.com/charmbracelet/log"
+	"sync"
+	"time"
+)
+
+const wantedBoardFileName = "wanted_board.json"
+
+// wantedEntry is a player on the SAK Wanted Board
+type wantedEntry struct {
+	PlayfabId  string   `json:"playfab_id"`
+	WantedFor  []string `json:"wanted_for"`
+	BanCommand string   `json:"ban_command"`
+	// Removed is only set in sync changes, for players that are no longer wanted
+	Removed bool `json:"removed,omitempty"`
+}
+
+// wantedBoardService fetches changes of the wanted board from the backend
+type wantedBoardService interface {
+	syncWantedBoard(ctx context.Context, cursor string) (changes []wantedEntry, nextCursor string, more bool, err error)
+}
+
+// wantedBoard is a local mirror of the wanted board. It is synced incrementally in the background,
+// so wanted players can be recognized instantly and without a connection to the backend.
+type wantedBoard struct {
+	lock     sync.RWMutex
+	interval time.Duration
+	state    wantedBoardState
+	lastErr  error
+}
+
+// wantedBoardState is the part of the mirror that is saved to disk
+type wantedBoardState struct {
+	Cursor   string                 `json:"cursor"`
+	LastSync time.Time              `json:"last_sync"`
+	Entries  map[string]wantedEntry `json:"entries"`
+}
+
+// loadWantedBoard reads the mirror from the config dir. It is synced every interval once syncLoop runs.
+func loadWantedBoard(interval time.Duration) (board *wantedBoard, err error) {
+	board = &wantedBoard{interval: interval}
+	err = loadJson(wantedBoardFileName, &board.state)
+	if err != nil {
+		// Start over with a full sync
+		board.state = wantedBoardState{}
+	}
+	if board.state.Entries == nil {
+		board.state.Entries = make(map[string]wantedEntry)
+	}
+	return
+}
+
+// syncLoop syncs the mirror immediately and then every interval until the context is cancelled
+func (board *wantedBoard) syncLoop(ctx context.Context, svc wantedBoardService) {
+	ticker := time.NewTicker(board.interval)
+	defer ticker.Stop()
+	for {
+		err := board.sync(ctx, svc)
+		if ctx.Err() != nil {
+			return
+		}
+		board.lock.Lock()
+		if err != nil && board.lastErr == nil {
+			// Only the first failure is logged, the sync status command shows the rest
+			log.Warn("Failed to sync wanted board, wanted players are recognized using the last synced state", "err", err)
+		}
+		board.lastErr = err
+		board.lock.Unlock()
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// sync fetches all changes since the last sync and saves the mirror
+func (board *wantedBoard) sync(ctx context.Context, svc wantedBoardService) error {
+	board.lock.RLock()
+	cursor := board.state.Cursor
+	board.lock.RUnlock()
+
+	for {
+		changes, nextCursor, more, err := svc.syncWantedBoard(ctx, cursor)
+		if err != nil {
+			return err
+		}
+		board.lock.Lock()
+		if cursor == "" {
+			// A full sync replaces everything
+			board.state.Entries = make(map[string]wantedEntry, len(changes))
+		}
+		for _, entry := range changes {
+			if entry.Removed {
+				delete(board.state.Entries, entry.PlayfabId)
+			} else {
+				board.state.Entries[entry.PlayfabId] = entry
+			}
+		}
+		board.state.Cursor = nextCursor
+		cursor = nextCursor
+		if !more {
+			board.state.LastSync = time.Now()
+		}
+		err = saveJson(wantedBoardFileName, board.state)
+		board.lock.Unlock()
+		if err != nil {
+			return err
+		}
+		if !more {
+			return nil
+		}
+	}
+}
+
+// upToDate reports whether the mirror is recent enough to skip the wanted board check of the backend
+func (board *wantedBoard) upToDate() bool {
+	board.lock.RLock()
+	defer board.lock.RUnlock()
+	return !board.state.LastSync.IsZero() && time.Since(board.state.LastSync) < 2*board.interval
+}
+
+// apply marks the players on the mirror as wanted and returns how many of them are listed.
+// The mirror only adds to what the backend reported, a wanted player it doesn't list might just not be synced yet.
+func (board *wantedBoard) apply(validatedPlayers []validatedPlayer) (wanted int) {
+	board.lock.RLock()
+	defer board.lock.RUnlock()
+	if board.state.LastSync.IsZero() {
+		return
+	}
+	for i, player := range validatedPlayers {
+		entry, ok := board.state.Entries[player.PlayfabId]
+		if ok {
+			validatedPlayers[i].WantedLevel = "wanted"
+			validatedPlayers[i].WantedFor = entry.WantedFor
+			validatedPlayers[i].BanCommand = entry.BanCommand
+			wanted++
+		}
+	}
+	return
+}
+
+// listed returns the players that are on the wanted board
+func (board *wantedBoard) listed(players []validatedPlayer) (wanted []validatedPlayer) {
+	board.lock.RLock()
+	defer board.lock.RUnlock()
+	for _, player := range players {
+		if _, ok := board.state.Entries[player.PlayfabId]; ok {
+			wanted = append(wanted, player)
+		}
+	}
+	return
+}
+
+// status describes the state of the mirror for the sync status command
+func (board *wantedBoard) status() (entries int, lastSync time.Time, cursor string, lastErr error) {
+	board.lock.RLock()
+	defer board.lock.RUnlock()
+	return len(board.state.Entries), board.state.LastSync, board.state.Cursor, board.lastErr
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestApplyWantedBoard(t *testing.T) {
+	board := &wantedBoard{interval: time.Hour, state: wantedBoardState{
+		LastSync: time.Now(),
+		Entries:  map[string]wantedEntry{"AAAA000000000001": {PlayfabId: "AAAA000000000001", WantedFor: []string{"spam"}}},
+	}}
+	tests := []struct {
+		name      string
+		player    validatedPlayer
+		wanted    int
+		wantLevel string
+		wantFor   []string
+	}{
+		{"listed", validatedPlayer{PlayfabId: "AAAA000000000001"}, 1, "wanted", []string{"spam"}},
+		{"clean", validatedPlayer{PlayfabId: "AAAA000000000002"}, 0, "", nil},
+		// The backend knows better than a mirror that might not be synced yet
+		{"wanted by the backend", validatedPlayer{PlayfabId: "AAAA000000000003", WantedLevel: "wanted", WantedFor: []string{"cheating"}}, 0, "wanted", []string{"cheating"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			players := []validatedPlayer{test.player}
+			if wanted := board.apply(players); wanted != test.wanted {
+				t.Errorf("wanted = %d, want %d", wanted, test.wanted)
+			}
+			if players[0].WantedLevel != test.wantLevel || !slices.Equal(players[0].WantedFor, test.wantFor) {
+				t.Errorf("player = %+v, want wanted level %q for %q", players[0], test.wantLevel, test.wantFor)
+			}
+		})
+	}
+}